@@ -0,0 +1,83 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+
+// AccessPolicy is the Schema for the accesspolicies API
+// +kubebuilder:printcolumn:name="Access Type",type="string",JSONPath=".spec.accessType",description="Whether matching traffic is allowed or denied"
+// +kubebuilder:printcolumn:name="Direction",type="string",JSONPath=".spec.direction",description="Direction of the traffic the policy applies to"
+// +kubebuilder:printcolumn:name="State",type="string",JSONPath=".status.state",description="The state of the policy in AWI"
+type AccessPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   AccessPolicySpec   `json:"spec,omitempty"`
+	Status AccessPolicyStatus `json:"status,omitempty"`
+}
+
+// AccessPolicySpec defines the traffic which app connections referencing
+// the policy by name are allowed (or denied) to send.
+type AccessPolicySpec struct {
+	Description string `json:"description,omitempty"`
+	// +kubebuilder:validation:Enum=ALLOW;DENY
+	// +kubebuilder:default=ALLOW
+	AccessType string `json:"accessType,omitempty"`
+	// +kubebuilder:validation:Enum=EGRESS;INGRESS
+	// +kubebuilder:default=EGRESS
+	Direction string `json:"direction,omitempty"`
+	Priority  int32  `json:"priority,omitempty"`
+	// +kubebuilder:validation:MinItems=1
+	Rules []AccessPolicyRule `json:"rules"`
+}
+
+// AccessPolicyRule matches traffic by protocol and an optional port
+// or port range such as "8000-8080".
+type AccessPolicyRule struct {
+	// +kubebuilder:validation:Enum=TCP;UDP;ICMP;ANY
+	Protocol string `json:"protocol"`
+	Port     string `json:"port,omitempty"`
+}
+
+type AccessPolicyStatus struct {
+	State   string `json:"state,omitempty"`
+	Message string `json:"message,omitempty"`
+	// PolicyName is the name of the policy in AWI, it's prefixed with the
+	// namespace so policies with the same name in different namespaces
+	// don't overwrite each other
+	PolicyName string `json:"policyName,omitempty"`
+	// ObservedGeneration is the generation of the spec sent to AWI
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// AccessPolicyList contains a list of AccessPolicy
+type AccessPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []AccessPolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&AccessPolicy{}, &AccessPolicyList{})
+}
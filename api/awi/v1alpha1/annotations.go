@@ -0,0 +1,70 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"strconv"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// AdoptedConnectionIdAnnotation holds the ID of a connection which
+	// already exists in AWI. Objects with this annotation take over the
+	// existing connection instead of creating a new one.
+	AdoptedConnectionIdAnnotation = "awi.app-net-interface.io/adopted-connection-id"
+	// DeletionPolicyAnnotation controls whether the connection in AWI is
+	// removed together with the object, see DeletionPolicyDelete and
+	// DeletionPolicyRetain.
+	DeletionPolicyAnnotation = "awi.app-net-interface.io/deletion-policy"
+	// SuspendAnnotation set to "true" stops the operator from making any
+	// AWI calls for the object, it takes precedence over spec.suspend.
+	SuspendAnnotation = "awi.app-net-interface.io/suspend"
+)
+
+const (
+	// DeletionPolicyDelete removes the connection from AWI when the object is deleted
+	DeletionPolicyDelete = "Delete"
+	// DeletionPolicyRetain leaves the connection in AWI when the object is deleted
+	DeletionPolicyRetain = "Retain"
+)
+
+const (
+	// ConditionSuspended is True while reconciliation of the object is suspended
+	ConditionSuspended = "Suspended"
+	// ConditionTerminalError is True if AWI rejected the object and it won't
+	// be retried until its spec changes
+	ConditionTerminalError = "TerminalError"
+	// ConditionDisconnectFailed is True if AWI rejected removal of the
+	// connection of the object being deleted, removal is retried with backoff
+	ConditionDisconnectFailed = "DisconnectFailed"
+)
+
+// StateMissing is set as the state of objects whose stored connection ID
+// is no longer known to AWI, it's handled as drift by the controllers
+const StateMissing = "MISSING"
+
+// suspended checks the suspend annotation of the object, the spec field
+// is used if the annotation isn't set or isn't a valid bool
+func suspended(obj metav1.Object, field bool) bool {
+	if value, ok := obj.GetAnnotations()[SuspendAnnotation]; ok {
+		if suspend, err := strconv.ParseBool(value); err == nil {
+			return suspend
+		}
+	}
+	return field
+}
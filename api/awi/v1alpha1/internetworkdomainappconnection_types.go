@@ -17,6 +17,8 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"encoding/json"
+
 	awi "github.com/app-net-interface/awi-grpc/pb"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -29,12 +31,66 @@ type InterNetworkDomainAppConnection struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
 
-	Spec   AppConnectionSpec `json:"spec,omitempty"`
-	Status string            `json:"status,omitempty"`
+	Spec   AppConnectionSpec                     `json:"spec,omitempty"`
+	Status InterNetworkDomainAppConnectionStatus `json:"status,omitempty"`
 }
 
 type AppConnectionSpec struct {
 	AppConnection awi.AppConnection `json:"appConnection,omitempty"`
+	// DeletionPolicy controls whether the app connection is removed from
+	// AWI when the object is deleted, it's overridden by the deletion-policy
+	// annotation. Defaults to Delete.
+	// +kubebuilder:validation:Enum=Delete;Retain
+	// +optional
+	DeletionPolicy string `json:"deletionPolicy,omitempty"`
+	// Suspend stops the operator from connecting, disconnecting and updating
+	// status of the app connection, e.g. during maintenance windows
+	// +optional
+	Suspend bool `json:"suspend,omitempty"`
+}
+
+type InterNetworkDomainAppConnectionStatus struct {
+	State string `json:"state,omitempty"`
+	// ConnectionId is the ID assigned to the app connection by AWI
+	ConnectionId string `json:"connection_id,omitempty"`
+	// ReplacedConnectionId is the ID of the app connection replaced by the
+	// one with ConnectionId, it's removed from AWI once the new one exists
+	ReplacedConnectionId string `json:"replaced_connection_id,omitempty"`
+	// ResolvedEndpoints are IPs of local pods selected by from.endpoint
+	// which were last sent to AWI
+	ResolvedEndpoints   []string     `json:"resolved_endpoints,omitempty"`
+	EndpointsUpdateTime *metav1.Time `json:"endpoints_update_time,omitempty"`
+	// GatewayEndpoint is the endpoint of the Gateway selected by
+	// to.service which was last sent to AWI
+	GatewayEndpoint *GatewayEndpoint `json:"gateway_endpoint,omitempty"`
+	DriftStatus     `json:",inline"`
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// GatewayEndpoint holds addresses and listener ports of a Gateway API Gateway
+type GatewayEndpoint struct {
+	Addresses []string `json:"addresses"`
+	Ports     []int32  `json:"ports"`
+}
+
+// IsSuspended checks if reconciliation of the app connection is suspended
+func (c *InterNetworkDomainAppConnection) IsSuspended() bool {
+	return suspended(c, c.Spec.Suspend)
+}
+
+// UnmarshalJSON accepts status stored by older versions of the operator,
+// when it was a plain string with the state.
+func (s *InterNetworkDomainAppConnectionStatus) UnmarshalJSON(data []byte) error {
+	var state string
+	if err := json.Unmarshal(data, &state); err == nil {
+		*s = InterNetworkDomainAppConnectionStatus{State: state}
+		return nil
+	}
+	type status InterNetworkDomainAppConnectionStatus
+	return json.Unmarshal(data, (*status)(s))
 }
 
 //+kubebuilder:object:root=true
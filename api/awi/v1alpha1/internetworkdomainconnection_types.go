@@ -30,10 +30,24 @@ type InterNetworkDomainConnection struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
 
-	Spec   awi.ConnectionRequest              `json:"spec,omitempty"`
+	Spec   InterNetworkDomainConnectionSpec   `json:"spec,omitempty"`
 	Status InterNetworkDomainConnectionStatus `json:"status,omitempty"`
 }
 
+type InterNetworkDomainConnectionSpec struct {
+	awi.ConnectionRequest `json:",inline"`
+	// DeletionPolicy controls whether the connection is removed from AWI
+	// when the object is deleted, it's overridden by the deletion-policy
+	// annotation. Defaults to Delete.
+	// +kubebuilder:validation:Enum=Delete;Retain
+	// +optional
+	DeletionPolicy string `json:"deletionPolicy,omitempty"`
+	// Suspend stops the operator from connecting, disconnecting and updating
+	// status of the connection, e.g. during maintenance windows
+	// +optional
+	Suspend bool `json:"suspend,omitempty"`
+}
+
 //+kubebuilder:object:root=true
 
 // InterNetworkDomainConnectionList contains a list of InterNetworkDomainConnection
@@ -46,6 +60,25 @@ type InterNetworkDomainConnectionList struct {
 type InterNetworkDomainConnectionStatus struct {
 	State        string `json:"state,omitempty"`
 	ConnectionId string `json:"connection_id,omitempty"`
+	DriftStatus  `json:",inline"`
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// DriftStatus records connections re-issued because they went missing or
+// failed in AWI
+type DriftStatus struct {
+	// ReconnectAttempts is the number of times the connection was re-issued
+	// since it was last seen working
+	ReconnectAttempts int32        `json:"reconnect_attempts,omitempty"`
+	LastReconnectTime *metav1.Time `json:"last_reconnect_time,omitempty"`
+}
+
+// IsSuspended checks if reconciliation of the connection is suspended
+func (c *InterNetworkDomainConnection) IsSuspended() bool {
+	return suspended(c, c.Spec.Suspend)
 }
 
 func init() {
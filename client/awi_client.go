@@ -21,28 +21,61 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/go-logr/logr"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
 	ctrl "sigs.k8s.io/controller-runtime"
 
 	awi "github.com/app-net-interface/awi-grpc/pb"
 )
 
+// Labels set in AWI metadata of connections and app connections created by
+// the operator, identifying the object they were created for.
+const (
+	OwnerClusterLabel   = "k8s-cluster"
+	OwnerNamespaceLabel = "k8s-namespace"
+	OwnerNameLabel      = "k8s-name"
+	OwnerUIDLabel       = "k8s-uid"
+)
+
+// DefaultCallTimeout is the deadline of AWI calls made with a context
+// without one
+const DefaultCallTimeout = 30 * time.Second
+
+// DefaultMaxMessageSize is the size limit of responses of AWI calls,
+// lists of Cloud objects come in a single response since AWI doesn't
+// paginate them
+const DefaultMaxMessageSize = 64 << 20
+
 type AwiGrpcClient struct {
-	logger                        logr.Logger
-	grpcConn                      *grpc.ClientConn
+	logger logr.Logger
+	// DefaultTimeout is the deadline of calls made with a context without
+	// one, DefaultCallTimeout is used if it's zero
+	DefaultTimeout                time.Duration
+	endpoints                     *endpointPool
 	ConnectionControllerClient    awi.ConnectionControllerClient
 	AppConnectionControllerClient awi.AppConnectionControllerClient
 	CloudClient                   awi.CloudClient
+	SecurityPolicyClient          awi.SecurityPolicyServiceClient
 }
 
-func NewClient(awiCatalystAddress string) *AwiGrpcClient {
-	awiClient := &AwiGrpcClient{}
+// NewClient connects to AWI server, calls are sent to the first healthy
+// of the given addresses. Connections are plaintext if transportCreds are
+// nil, creds are attached to every call unless they're nil, dialOpts are
+// added to the connection of each address.
+func NewClient(ctx context.Context, awiCatalystAddresses []string, defaultTimeout, healthCheckInterval time.Duration,
+	transportCreds credentials.TransportCredentials, creds credentials.PerRPCCredentials,
+	dialOpts ...grpc.DialOption) *AwiGrpcClient {
+	awiClient := &AwiGrpcClient{DefaultTimeout: defaultTimeout}
 	awiClient.WithLogger()
-	awiClient.WithConnection(awiCatalystAddress)
+	awiClient.WithEndpoints(ctx, awiCatalystAddresses, healthCheckInterval, transportCreds, creds, dialOpts...)
 	awiClient.WithGrpcClients()
 	return awiClient
 }
@@ -51,92 +84,168 @@ func (awiClient *AwiGrpcClient) WithLogger() {
 	awiClient.logger = ctrl.Log.WithName("grpc-client")
 }
 
-func (awiClient *AwiGrpcClient) WithConnection(awiCatalystAddress string) {
-	awiClient.logger.Info("connecting to grpc server", "address", awiCatalystAddress)
-	var err error
-	awiClient.grpcConn, err = grpc.Dial(awiCatalystAddress, grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithBlock())
-	if err != nil {
-		log.Fatalf("Failed to connect to grpc server at %s", awiCatalystAddress)
+// WithEndpoints connects to all the addresses and blocks until any of
+// them is healthy. Health of endpoints is checked in the background until
+// the context is done.
+func (awiClient *AwiGrpcClient) WithEndpoints(ctx context.Context, awiCatalystAddresses []string,
+	healthCheckInterval time.Duration, transportCreds credentials.TransportCredentials,
+	creds credentials.PerRPCCredentials, dialOpts ...grpc.DialOption) {
+	awiClient.logger.Info("connecting to grpc server", "addresses", awiCatalystAddresses,
+		"tls", transportCreds != nil)
+	if transportCreds == nil {
+		transportCreds = insecure.NewCredentials()
+	}
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(transportCreds),
+		// each attempt is traced, with its trace context passed to the server
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler())}
+	if creds != nil {
+		opts = append(opts, grpc.WithPerRPCCredentials(creds))
+	}
+	opts = append(opts, dialOpts...)
+	if healthCheckInterval == 0 {
+		healthCheckInterval = DefaultHealthCheckInterval
+	}
+	awiClient.endpoints = newEndpointPool(awiClient.logger, awiCatalystAddresses, awiClient.retryInterceptor, opts...)
+	go awiClient.endpoints.watch(ctx, healthCheckInterval)
+	if err := awiClient.endpoints.waitReady(ctx); err != nil {
+		log.Fatalf("Failed to connect to grpc server at %s", strings.Join(awiCatalystAddresses, ","))
 	}
-	awiClient.logger.Info("connected to grpc server at %s", "address", awiCatalystAddress)
+	awiClient.logger.Info("connected to grpc server", "address", awiClient.endpoints.current().address)
 }
 
 func (awiClient *AwiGrpcClient) WithGrpcClients() {
-	awiClient.ConnectionControllerClient = awi.NewConnectionControllerClient(awiClient.grpcConn)
-	awiClient.AppConnectionControllerClient = awi.NewAppConnectionControllerClient(awiClient.grpcConn)
-	awiClient.CloudClient = awi.NewCloudClient(awiClient.grpcConn)
+	awiClient.ConnectionControllerClient = awi.NewConnectionControllerClient(awiClient.endpoints)
+	awiClient.AppConnectionControllerClient = awi.NewAppConnectionControllerClient(awiClient.endpoints)
+	awiClient.CloudClient = awi.NewCloudClient(awiClient.endpoints)
+	awiClient.SecurityPolicyClient = awi.NewSecurityPolicyServiceClient(awiClient.endpoints)
 }
 
-func (awiClient *AwiGrpcClient) ConnectionRequest(connSpec *awi.ConnectionRequest) error {
+// callContext returns the context of a single AWI call, the default
+// deadline is set if the caller's context has none
+func (awiClient *AwiGrpcClient) callContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return context.WithCancel(ctx)
+	}
+	timeout := awiClient.DefaultTimeout
+	if timeout == 0 {
+		timeout = DefaultCallTimeout
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// ConnectionRequest sends connection to AWI and returns its ID assigned
+// by AWI server
+func (awiClient *AwiGrpcClient) ConnectionRequest(ctx context.Context, connSpec *awi.ConnectionRequest) (string, error) {
 	if connSpec == nil {
-		return fmt.Errorf("empty connection spec")
+		return "", status.Error(codes.InvalidArgument, "empty connection spec")
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := awiClient.callContext(ctx)
 	defer cancel()
 
 	awiClient.logger.Info("sending connection request", "connection name", connSpec.GetMetadata().GetName())
 	response, err := awiClient.ConnectionControllerClient.Connect(ctx, connSpec)
 	if err != nil {
-		return fmt.Errorf("error recevived from connection request: %v", err)
+		return "", fmt.Errorf("error recevived from connection request: %w", err)
 	}
 	awiClient.logger.Info("connection response", "response", response)
-	return nil
+	return response.GetConnectionId(), nil
 }
 
-func (awiClient *AwiGrpcClient) DisconnectRequest(connSpec *awi.ConnectionRequest) error {
+// DisconnectRequest removes connection with the given ID. Objects created
+// before IDs were stored have no ID, for them connection is looked up
+// by its spec.
+func (awiClient *AwiGrpcClient) DisconnectRequest(ctx context.Context, connSpec *awi.ConnectionRequest, id string) error {
 	if connSpec == nil {
-		return fmt.Errorf("empty connection spec")
+		return status.Error(codes.InvalidArgument, "empty connection spec")
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := awiClient.callContext(ctx)
 	defer cancel()
 
-	awiClient.logger.Info("sending disconnect request", "connection name", connSpec.GetMetadata().GetName())
-	connId := awiClient.GetConnectionId(connSpec)
+	if id == "" {
+		connections, err := awiClient.ConnectionControllerClient.ListConnections(ctx, &awi.ListConnectionsRequest{})
+		if err != nil {
+			return err
+		}
+		for _, conn := range connections.GetConnections() {
+			if MatchesConnection(conn, connSpec) {
+				id = conn.GetId()
+				break
+			}
+		}
+	}
+	if id == "" {
+		awiClient.logger.Info("Couldn't find connection matching to this connection spec",
+			"ConnSpec", connSpec)
+		return nil
+	}
+
+	awiClient.logger.Info("sending disconnect request", "connection name", connSpec.GetMetadata().GetName(), "id", id)
 	response, err := awiClient.ConnectionControllerClient.Disconnect(ctx, &awi.DisconnectRequest{
-		ConnectionId: connId,
+		ConnectionId: id,
 	})
+	if status.Code(err) == codes.NotFound {
+		awiClient.logger.Info("Connection was already removed", "id", id)
+		return nil
+	}
 	if err != nil {
-		return fmt.Errorf("error recevived from disconnection request: %v", err)
+		return fmt.Errorf("error recevived from disconnection request: %w", err)
 	}
 	awiClient.logger.Info("disconnect response", "response", response)
 	return nil
 }
 
-func (awiClient *AwiGrpcClient) AppConnectionRequest(connSpec *awi.AppConnection) error {
+// MatchesConnection checks if connection returned by AWI was created from
+// the spec. It's used only for connections without stored ID, which were
+// identified by source and destination IDs by older versions of the operator.
+func MatchesConnection(conn *awi.ConnectionInformation, connSpec *awi.ConnectionRequest) bool {
+	if id := legacyConnectionId(connSpec); id != "" && conn.GetId() == id {
+		return true
+	}
+	return connSpec.GetMetadata().GetName() != "" &&
+		conn.GetMetadata().GetName() == connSpec.GetMetadata().GetName() &&
+		conn.GetMetadata().GetNamespace() == connSpec.GetMetadata().GetNamespace()
+}
+
+// AppConnectionRequest sends app connection to AWI and returns its ID
+// assigned by AWI server
+func (awiClient *AwiGrpcClient) AppConnectionRequest(ctx context.Context, connSpec *awi.AppConnection) (string, error) {
 	if connSpec == nil {
-		return fmt.Errorf("empty app connection spec")
+		return "", status.Error(codes.InvalidArgument, "empty app connection spec")
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := awiClient.callContext(ctx)
 	defer cancel()
 
 	awiClient.logger.Info("sending app connection request", "app connection name", connSpec.GetMetadata().GetName())
 	response, err := awiClient.AppConnectionControllerClient.ConnectApps(ctx, connSpec)
 	if err != nil {
-		return fmt.Errorf("error recevived from app connection request: %v", err)
+		return "", fmt.Errorf("error recevived from app connection request: %w", err)
 	}
 	awiClient.logger.Info("app connection response", "response", response)
-	return nil
+	return response.GetAppConnId(), nil
 }
 
-func (awiClient *AwiGrpcClient) AppDisconnectRequest(connSpec *awi.AppConnection) error {
+// AppDisconnectRequest removes app connection with the given ID. Objects
+// created before IDs were stored have no ID, for them app connection
+// is looked up by its spec.
+func (awiClient *AwiGrpcClient) AppDisconnectRequest(ctx context.Context, connSpec *awi.AppConnection, id string) error {
 	if connSpec == nil {
-		return fmt.Errorf("empty app connection spec")
+		return status.Error(codes.InvalidArgument, "empty app connection spec")
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := awiClient.callContext(ctx)
 	defer cancel()
 
-	connections, err := awiClient.AppConnectionControllerClient.ListConnectedApps(ctx, &awi.ListAppConnectionsRequest{})
-	if err != nil {
-		return err
-	}
+	if id == "" {
+		connections, err := awiClient.AppConnectionControllerClient.ListConnectedApps(ctx, &awi.ListAppConnectionsRequest{})
+		if err != nil {
+			return err
+		}
 
-	// we don't know ID of app connection, so we look for matching one
-	id := ""
-	for _, conn := range connections.GetAppConnections() {
-		if conn.GetAppConnectionConfig().GetNetworkDomainConnection().GetSelector().GetMatchName() == connSpec.GetNetworkDomainConnection().GetSelector().GetMatchName() &&
-			conn.GetAppConnectionConfig().GetMetadata().GetName() == connSpec.GetMetadata().GetName() {
-			id = conn.GetId()
-			break
+		// we don't know ID of app connection, so we look for matching one
+		for _, conn := range connections.GetAppConnections() {
+			if MatchesAppConnection(conn.GetAppConnectionConfig(), connSpec) {
+				id = conn.GetId()
+				break
+			}
 		}
 	}
 	if id == "" {
@@ -149,15 +258,76 @@ func (awiClient *AwiGrpcClient) AppDisconnectRequest(connSpec *awi.AppConnection
 	response, err := awiClient.AppConnectionControllerClient.DisconnectApps(ctx, &awi.AppDisconnectionRequest{
 		ConnectionId: id,
 	})
+	if status.Code(err) == codes.NotFound {
+		awiClient.logger.Info("App connection was already removed", "id", id)
+		return nil
+	}
 	if err != nil {
-		return fmt.Errorf("error recevived from app disconnection request: %v", err)
+		return fmt.Errorf("error recevived from app disconnection request: %w", err)
 	}
 	awiClient.logger.Info("app disconnect response", "response", response)
 	return nil
 }
 
-func (awiClient *AwiGrpcClient) ListConnections() ([]*awi.ConnectionInformation, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+// MatchesAppConnection checks if app connection config returned by AWI
+// was created from the spec. It's used only for app connections without
+// stored ID, so namespace is compared only if both sides have it.
+func MatchesAppConnection(config *awi.AppConnection, connSpec *awi.AppConnection) bool {
+	if config.GetNetworkDomainConnection().GetSelector().GetMatchName() != connSpec.GetNetworkDomainConnection().GetSelector().GetMatchName() ||
+		config.GetMetadata().GetName() != connSpec.GetMetadata().GetName() {
+		return false
+	}
+	namespace, ok := config.GetMetadata().GetLabel()[OwnerNamespaceLabel]
+	specNamespace, specOk := connSpec.GetMetadata().GetLabel()[OwnerNamespaceLabel]
+	return !ok || !specOk || namespace == specNamespace
+}
+
+func (awiClient *AwiGrpcClient) AccessPolicyRequest(ctx context.Context, policy *awi.Security_AccessPolicy) (awi.Status, error) {
+	if policy == nil {
+		return awi.Status_FAILED, status.Error(codes.InvalidArgument, "empty access policy")
+	}
+	ctx, cancel := awiClient.callContext(ctx)
+	defer cancel()
+
+	awiClient.logger.Info("sending access policy request", "access policy name", policy.GetMetadata().GetName())
+	response, err := awiClient.SecurityPolicyClient.CreateAccessPolicy(ctx, &awi.AccessPolicyCreateRequest{
+		AccessPolicy: policy,
+	})
+	if err != nil {
+		return awi.Status_FAILED, fmt.Errorf("error recevived from access policy request: %w", err)
+	}
+	awiClient.logger.Info("access policy response", "response", response)
+	return response.GetStatus(), nil
+}
+
+func (awiClient *AwiGrpcClient) DeleteAccessPolicyRequest(ctx context.Context, name string) error {
+	ctx, cancel := awiClient.callContext(ctx)
+	defer cancel()
+
+	awiClient.logger.Info("sending delete access policy request", "access policy name", name)
+	response, err := awiClient.SecurityPolicyClient.DeleteAccessPolicy(ctx, &awi.AccessPolicyDeleteRequest{
+		Name: name,
+	})
+	if err != nil {
+		return fmt.Errorf("error recevived from delete access policy request: %w", err)
+	}
+	awiClient.logger.Info("delete access policy response", "response", response)
+	return nil
+}
+
+func (awiClient *AwiGrpcClient) ListAccessPolicies(ctx context.Context) ([]*awi.Security_AccessPolicy, error) {
+	ctx, cancel := awiClient.callContext(ctx)
+	defer cancel()
+	policies, err := awiClient.SecurityPolicyClient.ListAccessPolicies(ctx, &awi.AccessPolicyListRequest{})
+	if err != nil {
+		awiClient.logger.Error(err, "failed to list access policies")
+		return nil, err
+	}
+	return policies.GetAccessPolicies(), nil
+}
+
+func (awiClient *AwiGrpcClient) ListConnections(ctx context.Context) ([]*awi.ConnectionInformation, error) {
+	ctx, cancel := awiClient.callContext(ctx)
 	defer cancel()
 	connections, err := awiClient.ConnectionControllerClient.ListConnections(ctx, &awi.ListConnectionsRequest{})
 	if err != nil {
@@ -167,8 +337,8 @@ func (awiClient *AwiGrpcClient) ListConnections() ([]*awi.ConnectionInformation,
 	return connections.GetConnections(), nil
 }
 
-func (awiClient *AwiGrpcClient) ListAppConnections() ([]*awi.AppConnectionInformation, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+func (awiClient *AwiGrpcClient) ListAppConnections(ctx context.Context) ([]*awi.AppConnectionInformation, error) {
+	ctx, cancel := awiClient.callContext(ctx)
 	defer cancel()
 	connections, err := awiClient.AppConnectionControllerClient.ListConnectedApps(ctx, &awi.ListAppConnectionsRequest{})
 	if err != nil {
@@ -178,14 +348,19 @@ func (awiClient *AwiGrpcClient) ListAppConnections() ([]*awi.AppConnectionInform
 	return connections.GetAppConnections(), nil
 }
 
-func (awiClient *AwiGrpcClient) GetConnectionId(connSpec *awi.ConnectionRequest) string {
-	return fmt.Sprintf("%s:%s",
-		connSpec.GetSpec().GetSource().GetNetworkDomain().GetSelector().GetMatchId().GetId(),
-		connSpec.GetSpec().GetDestination().GetNetworkDomain().GetSelector().GetMatchId().GetId())
+// legacyConnectionId returns the ID used to be assumed for connections
+// between network domains selected by IDs
+func legacyConnectionId(connSpec *awi.ConnectionRequest) string {
+	source := connSpec.GetSpec().GetSource().GetNetworkDomain().GetSelector().GetMatchId().GetId()
+	destination := connSpec.GetSpec().GetDestination().GetNetworkDomain().GetSelector().GetMatchId().GetId()
+	if source == "" || destination == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s:%s", source, destination)
 }
 
-func (awiClient *AwiGrpcClient) ListVPCs(provider string) ([]*awi.VPC, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+func (awiClient *AwiGrpcClient) ListVPCs(ctx context.Context, provider string) ([]*awi.VPC, error) {
+	ctx, cancel := awiClient.callContext(ctx)
 	defer cancel()
 	vpcsResp, err := awiClient.CloudClient.ListVPCs(ctx, &awi.ListVPCRequest{
 		Provider: provider,
@@ -196,8 +371,8 @@ func (awiClient *AwiGrpcClient) ListVPCs(provider string) ([]*awi.VPC, error) {
 	return vpcsResp.VPCs, nil
 }
 
-func (awiClient *AwiGrpcClient) ListInstances(provider string) ([]*awi.Instance, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+func (awiClient *AwiGrpcClient) ListInstances(ctx context.Context, provider string) ([]*awi.Instance, error) {
+	ctx, cancel := awiClient.callContext(ctx)
 	defer cancel()
 	instancesResp, err := awiClient.CloudClient.ListInstances(ctx, &awi.ListInstancesRequest{
 		Provider: provider,
@@ -208,8 +383,8 @@ func (awiClient *AwiGrpcClient) ListInstances(provider string) ([]*awi.Instance,
 	return instancesResp.Instances, nil
 }
 
-func (awiClient *AwiGrpcClient) ListSites() ([]*awi.SiteDetail, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+func (awiClient *AwiGrpcClient) ListSites(ctx context.Context) ([]*awi.SiteDetail, error) {
+	ctx, cancel := awiClient.callContext(ctx)
 	defer cancel()
 	siteResp, err := awiClient.CloudClient.ListSites(ctx, &awi.ListSiteRequest{})
 	if err != nil {
@@ -218,8 +393,8 @@ func (awiClient *AwiGrpcClient) ListSites() ([]*awi.SiteDetail, error) {
 	return siteResp.Sites, nil
 }
 
-func (awiClient *AwiGrpcClient) ListSubnets(provider string) ([]*awi.Subnet, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+func (awiClient *AwiGrpcClient) ListSubnets(ctx context.Context, provider string) ([]*awi.Subnet, error) {
+	ctx, cancel := awiClient.callContext(ctx)
 	defer cancel()
 	subnetResp, err := awiClient.CloudClient.ListSubnets(ctx, &awi.ListSubnetRequest{
 		Provider: provider,
@@ -230,8 +405,8 @@ func (awiClient *AwiGrpcClient) ListSubnets(provider string) ([]*awi.Subnet, err
 	return subnetResp.Subnets, nil
 }
 
-func (awiClient *AwiGrpcClient) ListVPNs() ([]*awi.VPN, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+func (awiClient *AwiGrpcClient) ListVPNs(ctx context.Context) ([]*awi.VPN, error) {
+	ctx, cancel := awiClient.callContext(ctx)
 	defer cancel()
 	vpnResp, err := awiClient.CloudClient.ListVPNs(ctx, &awi.ListVPNRequest{})
 	if err != nil {
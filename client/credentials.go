@@ -0,0 +1,133 @@
+// Copyright (c) 2023 Cisco Systems, Inc. and its affiliates
+// All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http:www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+	"google.golang.org/grpc/credentials"
+)
+
+// ClusterMetadataKey is the metadata key carrying the name of the cluster
+// the call comes from, so AWI server can authorize and audit per cluster
+const ClusterMetadataKey = "x-awi-cluster"
+
+// tokenFileRefresh is how long a token read from a file is used before the
+// file is read again, kubelet updates mounted Secrets and rotates
+// projected ServiceAccount tokens in place, it's shortened by tests
+var tokenFileRefresh = time.Minute
+
+// Credentials attach a bearer token and the cluster identity to every
+// call made to AWI
+type Credentials struct {
+	// TokenSource provides the bearer token, no token is sent if it's nil
+	TokenSource oauth2.TokenSource
+	ClusterName string
+}
+
+var _ credentials.PerRPCCredentials = &Credentials{}
+
+func (c *Credentials) GetRequestMetadata(ctx context.Context, _ ...string) (map[string]string, error) {
+	md := map[string]string{}
+	if c.ClusterName != "" {
+		md[ClusterMetadataKey] = c.ClusterName
+	}
+	if c.TokenSource != nil {
+		token, err := c.TokenSource.Token()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get AWI token: %w", err)
+		}
+		md["authorization"] = token.Type() + " " + token.AccessToken
+	}
+	return md, nil
+}
+
+// RequireTransportSecurity makes gRPC refuse to send a token over a
+// plaintext connection, the cluster identity alone may be sent over one
+func (c *Credentials) RequireTransportSecurity() bool {
+	return c.TokenSource != nil
+}
+
+// TransportCredentials returns TLS credentials verifying AWI server with
+// CA certificates from the PEM file, or with system roots if it's empty
+func TransportCredentials(caFile string) (credentials.TransportCredentials, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile != "" {
+		data, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read AWI CA certificates: %w", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no CA certificates found in %s", caFile)
+		}
+	}
+	return credentials.NewTLS(config), nil
+}
+
+type fileTokenSource struct {
+	path string
+}
+
+// FileTokenSource reads the bearer token from the file, e.g. a mounted
+// Secret or a projected ServiceAccount token. The file is read again every
+// minute, so rotated tokens are picked up.
+func FileTokenSource(path string) oauth2.TokenSource {
+	return oauth2.ReuseTokenSource(nil, &fileTokenSource{path: path})
+}
+
+func (s *fileTokenSource) Token() (*oauth2.Token, error) {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return nil, fmt.Errorf("token file %s is empty", s.path)
+	}
+	return &oauth2.Token{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		Expiry:      time.Now().Add(tokenFileRefresh),
+	}, nil
+}
+
+// ClientCredentialsTokenSource gets tokens from the OIDC provider with the
+// client credentials flow, tokens are requested again before they expire
+func ClientCredentialsTokenSource(ctx context.Context, tokenURL, clientID, clientSecretFile string,
+	scopes []string) (oauth2.TokenSource, error) {
+	secret, err := os.ReadFile(clientSecretFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read OIDC client secret: %w", err)
+	}
+	config := &clientcredentials.Config{
+		ClientID:     clientID,
+		ClientSecret: strings.TrimSpace(string(secret)),
+		TokenURL:     tokenURL,
+		Scopes:       scopes,
+	}
+	return config.TokenSource(ctx), nil
+}
@@ -0,0 +1,149 @@
+// Copyright (c) 2023 Cisco Systems, Inc. and its affiliates
+// All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http:www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package client
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// stubTokenSource returns the token or the error it holds
+type stubTokenSource struct {
+	token *oauth2.Token
+	err   error
+}
+
+func (s *stubTokenSource) Token() (*oauth2.Token, error) {
+	return s.token, s.err
+}
+
+func TestCredentialsGetRequestMetadata(t *testing.T) {
+	tests := []struct {
+		name          string
+		creds         Credentials
+		want          map[string]string
+		wantErr       bool
+		wantTransport bool
+	}{
+		{name: "nothing", want: map[string]string{}},
+		{
+			name:  "cluster only",
+			creds: Credentials{ClusterName: "cluster-a"},
+			want:  map[string]string{ClusterMetadataKey: "cluster-a"},
+		},
+		{
+			name: "token and cluster",
+			creds: Credentials{
+				ClusterName: "cluster-a",
+				TokenSource: &stubTokenSource{token: &oauth2.Token{AccessToken: "secret", TokenType: "Bearer"}},
+			},
+			want:          map[string]string{ClusterMetadataKey: "cluster-a", "authorization": "Bearer secret"},
+			wantTransport: true,
+		},
+		{
+			name:          "token without type",
+			creds:         Credentials{TokenSource: &stubTokenSource{token: &oauth2.Token{AccessToken: "secret"}}},
+			want:          map[string]string{"authorization": "Bearer secret"},
+			wantTransport: true,
+		},
+		{
+			name:          "token error",
+			creds:         Credentials{TokenSource: &stubTokenSource{err: errors.New("expired")}},
+			wantErr:       true,
+			wantTransport: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.creds.GetRequestMetadata(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetRequestMetadata() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetRequestMetadata() = %v, want %v", got, tt.want)
+			}
+			if got := tt.creds.RequireTransportSecurity(); got != tt.wantTransport {
+				t.Errorf("RequireTransportSecurity() = %v, want %v", got, tt.wantTransport)
+			}
+		})
+	}
+}
+
+func writeToken(t *testing.T, path, token string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(token), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileTokenSource(t *testing.T) {
+	refresh := tokenFileRefresh
+	t.Cleanup(func() { tokenFileRefresh = refresh })
+
+	tests := []struct {
+		name    string
+		refresh time.Duration
+		want    string
+	}{
+		{name: "token reused until refresh", refresh: time.Hour, want: "first"},
+		{name: "changed file read again", refresh: 0, want: "second"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokenFileRefresh = tt.refresh
+			path := filepath.Join(t.TempDir(), "token")
+			writeToken(t, path, "first\n")
+			creds := Credentials{TokenSource: FileTokenSource(path)}
+
+			md, err := creds.GetRequestMetadata(context.Background())
+			if err != nil {
+				t.Fatalf("GetRequestMetadata() error = %v", err)
+			}
+			if got := md["authorization"]; got != "Bearer first" {
+				t.Fatalf("authorization = %q, want %q", got, "Bearer first")
+			}
+
+			writeToken(t, path, "second")
+			md, err = creds.GetRequestMetadata(context.Background())
+			if err != nil {
+				t.Fatalf("GetRequestMetadata() error = %v", err)
+			}
+			if got := md["authorization"]; got != "Bearer "+tt.want {
+				t.Errorf("authorization after the file changed = %q, want %q", got, "Bearer "+tt.want)
+			}
+		})
+	}
+}
+
+func TestFileTokenSourceErrors(t *testing.T) {
+	dir := t.TempDir()
+	empty := filepath.Join(dir, "empty")
+	writeToken(t, empty, " \n")
+	for _, path := range []string{empty, filepath.Join(dir, "missing")} {
+		if _, err := FileTokenSource(path).Token(); err == nil {
+			t.Errorf("Token() of %s succeeded", filepath.Base(path))
+		}
+	}
+}
@@ -0,0 +1,367 @@
+// Copyright (c) 2023 Cisco Systems, Inc. and its affiliates
+// All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http:www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+// DefaultHealthCheckInterval is how often health of AWI endpoints is
+// checked and DNS names of endpoints are resolved again
+const DefaultHealthCheckInterval = 10 * time.Second
+
+const (
+	healthCheckTimeout = 5 * time.Second
+	// dnsPrefix marks endpoints whose name is resolved to several backends,
+	// each of them being a separate endpoint
+	dnsPrefix = "dns:///"
+)
+
+var (
+	activeEndpoint = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "awi_endpoint_active",
+		Help: "Whether calls to AWI are sent to the endpoint",
+	}, []string{"address"})
+	healthyEndpoint = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "awi_endpoint_healthy",
+		Help: "Whether the AWI endpoint passed the last health check",
+	}, []string{"address"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(activeEndpoint, healthyEndpoint)
+}
+
+// EndpointStatus describes an AWI endpoint in the status endpoint
+type EndpointStatus struct {
+	Address string `json:"address"`
+	Healthy bool   `json:"healthy"`
+	Active  bool   `json:"active"`
+}
+
+type endpoint struct {
+	address string
+	conn    *grpc.ClientConn
+	healthy bool
+}
+
+// endpointPool sends calls to one of the healthy AWI endpoints and fails
+// over to the next one, in the order they were given, once it goes down.
+// The active endpoint is kept as long as it's healthy.
+type endpointPool struct {
+	logger   logr.Logger
+	targets  []string
+	dialOpts []grpc.DialOption
+	// interceptor wraps every call, each attempt it makes goes to the
+	// endpoint active at the time
+	interceptor grpc.UnaryClientInterceptor
+	// lookupHost resolves names of dns:/// endpoints
+	lookupHost func(ctx context.Context, host string) ([]string, error)
+
+	mu        sync.RWMutex
+	resolved  map[string][]string
+	endpoints []*endpoint
+	active    *endpoint
+	ready     chan struct{}
+	readyOnce sync.Once
+}
+
+var _ grpc.ClientConnInterface = &endpointPool{}
+
+func newEndpointPool(logger logr.Logger, targets []string, interceptor grpc.UnaryClientInterceptor,
+	dialOpts ...grpc.DialOption) *endpointPool {
+	return &endpointPool{
+		logger:      logger,
+		targets:     targets,
+		dialOpts:    dialOpts,
+		interceptor: interceptor,
+		lookupHost:  net.DefaultResolver.LookupHost,
+		resolved:    map[string][]string{},
+		ready:       make(chan struct{}),
+	}
+}
+
+func (p *endpointPool) Invoke(ctx context.Context, method string, args, reply interface{}, opts ...grpc.CallOption) error {
+	return p.interceptor(ctx, method, args, reply, nil, p.invoke, opts...)
+}
+
+func (p *endpointPool) invoke(ctx context.Context, method string, args, reply interface{}, _ *grpc.ClientConn,
+	opts ...grpc.CallOption) error {
+	e := p.current()
+	if e == nil {
+		return status.Error(codes.Unavailable, "no healthy AWI endpoint")
+	}
+	err := e.conn.Invoke(ctx, method, args, reply, opts...)
+	if status.Code(err) == codes.Unavailable {
+		p.markUnhealthy(e, err)
+	}
+	return err
+}
+
+// NewStream opens the stream to the active endpoint, streams aren't moved
+// to another endpoint once they're open
+func (p *endpointPool) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string,
+	opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	e := p.current()
+	if e == nil {
+		return nil, status.Error(codes.Unavailable, "no healthy AWI endpoint")
+	}
+	stream, err := e.conn.NewStream(ctx, desc, method, opts...)
+	if status.Code(err) == codes.Unavailable {
+		p.markUnhealthy(e, err)
+	}
+	return stream, err
+}
+
+func (p *endpointPool) current() *endpoint {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.active
+}
+
+func (p *endpointPool) markUnhealthy(e *endpoint, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !e.healthy {
+		return
+	}
+	p.logger.Info("AWI endpoint is unavailable", "address", e.address, "error", err.Error())
+	e.healthy = false
+	healthyEndpoint.WithLabelValues(e.address).Set(0)
+	p.selectActive()
+}
+
+// selectActive keeps the active endpoint if it's healthy and picks the
+// first healthy one otherwise. Calls keep going to the last active
+// endpoint while none is healthy. It must be called with the lock held.
+func (p *endpointPool) selectActive() {
+	if p.active != nil && p.active.healthy {
+		return
+	}
+	var next *endpoint
+	for _, e := range p.endpoints {
+		if e.healthy {
+			next = e
+			break
+		}
+	}
+	if next == nil {
+		return
+	}
+	if p.active != nil {
+		activeEndpoint.WithLabelValues(p.active.address).Set(0)
+	}
+	p.active = next
+	activeEndpoint.WithLabelValues(next.address).Set(1)
+	p.logger.Info("switched to AWI endpoint", "address", next.address)
+	p.readyOnce.Do(func() { close(p.ready) })
+}
+
+// waitReady blocks until any endpoint is healthy
+func (p *endpointPool) waitReady(ctx context.Context) error {
+	select {
+	case <-p.ready:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// watch checks health of endpoints until the context is done, then
+// closes their connections
+func (p *endpointPool) watch(ctx context.Context, interval time.Duration) {
+	p.refresh(ctx)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.refresh(ctx)
+		case <-ctx.Done():
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			for _, e := range p.endpoints {
+				e.conn.Close()
+			}
+			return
+		}
+	}
+}
+
+// refresh resolves endpoint addresses, connects to new ones, closes
+// removed ones and checks health of all of them
+func (p *endpointPool) refresh(ctx context.Context) {
+	addresses := p.resolve(ctx)
+
+	p.mu.RLock()
+	existing := make(map[string]*endpoint, len(p.endpoints))
+	for _, e := range p.endpoints {
+		existing[e.address] = e
+	}
+	p.mu.RUnlock()
+
+	endpoints := make([]*endpoint, 0, len(addresses))
+	for _, address := range addresses {
+		if e, ok := existing[address]; ok {
+			endpoints = append(endpoints, e)
+			delete(existing, address)
+			continue
+		}
+		conn, err := grpc.DialContext(ctx, address, p.dialOpts...)
+		if err != nil {
+			p.logger.Error(err, "failed to create connection to AWI endpoint", "address", address)
+			continue
+		}
+		endpoints = append(endpoints, &endpoint{address: address, conn: conn})
+	}
+
+	healthy := make([]bool, len(endpoints))
+	var wg sync.WaitGroup
+	for i, e := range endpoints {
+		wg.Add(1)
+		go func(i int, e *endpoint) {
+			defer wg.Done()
+			healthy[i] = checkHealth(ctx, e.conn)
+		}(i, e)
+	}
+	wg.Wait()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, e := range endpoints {
+		if e.healthy != healthy[i] {
+			p.logger.Info("AWI endpoint health changed", "address", e.address, "healthy", healthy[i])
+		}
+		e.healthy = healthy[i]
+		healthyEndpoint.WithLabelValues(e.address).Set(boolToFloat(e.healthy))
+	}
+	for _, e := range existing {
+		p.logger.Info("AWI endpoint removed", "address", e.address)
+		e.conn.Close()
+		healthyEndpoint.DeleteLabelValues(e.address)
+		activeEndpoint.DeleteLabelValues(e.address)
+		if p.active == e {
+			p.active = nil
+		}
+	}
+	p.endpoints = endpoints
+	p.selectActive()
+}
+
+// resolve returns addresses of all endpoints, names prefixed with dns:///
+// are resolved to addresses of all their backends. Addresses resolved
+// before are kept if the name can't be resolved now.
+func (p *endpointPool) resolve(ctx context.Context) []string {
+	var addresses []string
+	for _, target := range p.targets {
+		if !strings.HasPrefix(target, dnsPrefix) {
+			addresses = append(addresses, target)
+			continue
+		}
+		host, port, err := net.SplitHostPort(strings.TrimPrefix(target, dnsPrefix))
+		if err != nil {
+			p.logger.Error(err, "invalid AWI endpoint", "endpoint", target)
+			continue
+		}
+		ips, err := p.lookupHost(ctx, host)
+		if err != nil {
+			p.logger.Error(err, "failed to resolve AWI endpoint", "endpoint", target)
+			addresses = append(addresses, p.resolved[target]...)
+			continue
+		}
+		resolved := make([]string, 0, len(ips))
+		for _, ip := range ips {
+			resolved = append(resolved, net.JoinHostPort(ip, port))
+		}
+		p.resolved[target] = resolved
+		addresses = append(addresses, resolved...)
+	}
+	return addresses
+}
+
+// checkHealth runs the grpc.health.v1 check, servers which don't implement
+// it are healthy as long as they can be reached
+func checkHealth(ctx context.Context, conn *grpc.ClientConn) bool {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	if status.Code(err) == codes.Unimplemented {
+		return true
+	}
+	return err == nil && resp.GetStatus() == healthpb.HealthCheckResponse_SERVING
+}
+
+func (p *endpointPool) statuses() []EndpointStatus {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	statuses := make([]EndpointStatus, 0, len(p.endpoints))
+	for _, e := range p.endpoints {
+		statuses = append(statuses, EndpointStatus{Address: e.address, Healthy: e.healthy, Active: e == p.active})
+	}
+	return statuses
+}
+
+// ConnectivityCheck is a readiness check passing when the channel to the
+// active AWI endpoint isn't failing and the endpoint passes the
+// grpc.health.v1 check, if it implements it
+func (awiClient *AwiGrpcClient) ConnectivityCheck(req *http.Request) error {
+	e := awiClient.endpoints.current()
+	if e == nil {
+		return fmt.Errorf("no AWI endpoint is healthy")
+	}
+	if state := e.conn.GetState(); state == connectivity.TransientFailure || state == connectivity.Shutdown {
+		return fmt.Errorf("channel to AWI endpoint %s is in %s state", e.address, state)
+	}
+	if !checkHealth(req.Context(), e.conn) {
+		return fmt.Errorf("AWI endpoint %s isn't serving", e.address)
+	}
+	return nil
+}
+
+// EndpointsHandler serves statuses of AWI endpoints as JSON
+func (awiClient *AwiGrpcClient) EndpointsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(awiClient.endpoints.statuses()); err != nil {
+			awiClient.logger.Error(err, "failed to write AWI endpoints status")
+		}
+	})
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,200 @@
+// Copyright (c) 2023 Cisco Systems, Inc. and its affiliates
+// All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http:www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// healthServer is an AWI endpoint serving only grpc.health.v1
+type healthServer struct {
+	address string
+	server  *grpc.Server
+	health  *health.Server
+}
+
+func startHealthServer(t *testing.T, address string) *healthServer {
+	t.Helper()
+	lis, err := net.Listen("tcp", address)
+	if err != nil {
+		t.Fatalf("failed to listen on %s: %v", address, err)
+	}
+	s := &healthServer{address: lis.Addr().String(), server: grpc.NewServer(), health: health.NewServer()}
+	healthpb.RegisterHealthServer(s.server, s.health)
+	go s.server.Serve(lis)
+	t.Cleanup(s.server.Stop)
+	return s
+}
+
+func (s *healthServer) setServing(serving bool) {
+	status := healthpb.HealthCheckResponse_SERVING
+	if !serving {
+		status = healthpb.HealthCheckResponse_NOT_SERVING
+	}
+	s.health.SetServingStatus("", status)
+}
+
+func passThrough(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn,
+	invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
+
+func newTestPool(t *testing.T, targets ...string) *endpointPool {
+	t.Helper()
+	p := newEndpointPool(logr.Discard(), targets, passThrough,
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	t.Cleanup(func() {
+		for _, e := range p.endpoints {
+			e.conn.Close()
+		}
+	})
+	return p
+}
+
+func activeAddress(p *endpointPool) string {
+	if e := p.current(); e != nil {
+		return e.address
+	}
+	return ""
+}
+
+func TestEndpointPoolFailover(t *testing.T) {
+	ctx := context.Background()
+	first := startHealthServer(t, "127.0.0.1:0")
+	second := startHealthServer(t, "127.0.0.1:0")
+	p := newTestPool(t, first.address, second.address)
+
+	steps := []struct {
+		name          string
+		firstServing  bool
+		secondServing bool
+		wantActive    string
+	}{
+		{name: "first of healthy", firstServing: true, secondServing: true, wantActive: first.address},
+		{name: "fail over", firstServing: false, secondServing: true, wantActive: second.address},
+		{name: "keep healthy active", firstServing: true, secondServing: true, wantActive: second.address},
+		{name: "fail back", firstServing: true, secondServing: false, wantActive: first.address},
+		{name: "keep last active while none is healthy", firstServing: false, secondServing: false,
+			wantActive: first.address},
+		{name: "recover", firstServing: false, secondServing: true, wantActive: second.address},
+	}
+	for _, step := range steps {
+		first.setServing(step.firstServing)
+		second.setServing(step.secondServing)
+		p.refresh(ctx)
+		if got := activeAddress(p); got != step.wantActive {
+			t.Fatalf("%s: active endpoint = %q, want %q", step.name, got, step.wantActive)
+		}
+	}
+}
+
+func TestEndpointPoolReady(t *testing.T) {
+	ctx := context.Background()
+	server := startHealthServer(t, "127.0.0.1:0")
+	server.setServing(false)
+	p := newTestPool(t, server.address)
+
+	p.refresh(ctx)
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := p.waitReady(canceled); err == nil {
+		t.Fatalf("waitReady() = nil while no endpoint is healthy")
+	}
+
+	server.setServing(true)
+	p.refresh(ctx)
+	if err := p.waitReady(ctx); err != nil {
+		t.Fatalf("waitReady() error = %v", err)
+	}
+}
+
+func TestEndpointPoolMarkUnhealthyOnUnavailable(t *testing.T) {
+	ctx := context.Background()
+	first := startHealthServer(t, "127.0.0.1:0")
+	second := startHealthServer(t, "127.0.0.1:0")
+	first.setServing(true)
+	second.setServing(true)
+	p := newTestPool(t, first.address, second.address)
+	p.refresh(ctx)
+
+	first.server.Stop()
+	client := healthpb.NewHealthClient(p)
+	if _, err := client.Check(ctx, &healthpb.HealthCheckRequest{}); err == nil {
+		t.Fatalf("Check() on stopped endpoint succeeded")
+	}
+	if got := activeAddress(p); got != second.address {
+		t.Fatalf("active endpoint = %q, want %q", got, second.address)
+	}
+	if _, err := client.Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatalf("Check() after failover error = %v", err)
+	}
+}
+
+func TestEndpointPoolDNSRefresh(t *testing.T) {
+	ctx := context.Background()
+	first := startHealthServer(t, "127.0.0.1:0")
+	first.setServing(true)
+	_, port, err := net.SplitHostPort(first.address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second := startHealthServer(t, net.JoinHostPort("127.0.0.2", port))
+	second.setServing(true)
+
+	p := newTestPool(t, dnsPrefix+net.JoinHostPort("awi.example", port))
+	var ips []string
+	var lookupErr error
+	p.lookupHost = func(_ context.Context, host string) ([]string, error) {
+		if host != "awi.example" {
+			t.Errorf("lookupHost(%q), want awi.example", host)
+		}
+		return ips, lookupErr
+	}
+
+	steps := []struct {
+		name       string
+		ips        []string
+		lookupErr  error
+		wantActive string
+		wantCount  int
+	}{
+		{name: "resolved", ips: []string{"127.0.0.1"}, wantActive: first.address, wantCount: 1},
+		{name: "backend added", ips: []string{"127.0.0.1", "127.0.0.2"}, wantActive: first.address, wantCount: 2},
+		{name: "active backend removed", ips: []string{"127.0.0.2"}, wantActive: second.address, wantCount: 1},
+		{name: "resolution failed", lookupErr: errors.New("no such host"), wantActive: second.address, wantCount: 1},
+	}
+	for _, step := range steps {
+		ips, lookupErr = step.ips, step.lookupErr
+		p.refresh(ctx)
+		if got := activeAddress(p); got != step.wantActive {
+			t.Fatalf("%s: active endpoint = %q, want %q", step.name, got, step.wantActive)
+		}
+		if got := len(p.statuses()); got != step.wantCount {
+			t.Fatalf("%s: %d endpoints, want %d", step.name, got, step.wantCount)
+		}
+	}
+}
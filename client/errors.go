@@ -0,0 +1,100 @@
+// Copyright (c) 2023 Cisco Systems, Inc. and its affiliates
+// All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http:www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package client
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// maxRetries is how many times a call failed with a retryable error is
+// sent again before the error is returned
+const maxRetries = 4
+
+// backoff between retries, they're shortened by tests
+var (
+	retryBackoffBase = 200 * time.Millisecond
+	retryBackoffMax  = 5 * time.Second
+)
+
+// nonIdempotentMethods create a new object in AWI on every call, a call
+// which failed after it reached the server may have created one already,
+// so they're never retried here and failures are left to the reconcilers.
+var nonIdempotentMethods = map[string]bool{
+	"/ConnectionController/Connect":                      true,
+	"/AppConnectionController/ConnectApps":               true,
+	"/AppConnectionController/CreateAppConnectionPolicy": true,
+	"/SecurityPolicyService/CreateAccessPolicy":          true,
+	"/NetworkSLAService/CreateNetworkSLA":                true,
+}
+
+// IsRetryable checks if the AWI call failed with a transient error, which
+// may succeed when it's sent again
+func IsRetryable(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted:
+		return true
+	}
+	return false
+}
+
+// IsTerminal checks if the AWI call was rejected because of the request
+// itself, so sending it again won't help until it's changed
+func IsTerminal(err error) bool {
+	switch status.Code(err) {
+	case codes.InvalidArgument, codes.NotFound, codes.AlreadyExists:
+		return true
+	}
+	return false
+}
+
+// retryInterceptor sends calls failed with retryable errors again with
+// jittered exponential backoff, as long as the call context isn't done.
+// Calls creating objects aren't retried, see nonIdempotentMethods.
+func (awiClient *AwiGrpcClient) retryInterceptor(ctx context.Context, method string, req, reply interface{},
+	cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	if nonIdempotentMethods[method] {
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+	backoff := retryBackoffBase
+	for attempt := 1; ; attempt++ {
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		if err == nil || !IsRetryable(err) || attempt > maxRetries || ctx.Err() != nil {
+			return err
+		}
+		delay := wait.Jitter(backoff, 1.0)
+		awiClient.logger.Info("retrying AWI call", "method", method, "attempt", attempt,
+			"after", delay, "error", err.Error())
+		trace.SpanFromContext(ctx).AddEvent("retrying AWI call", trace.WithAttributes(
+			attribute.String("rpc.method", method), attribute.Int("attempt", attempt),
+			attribute.String("error", err.Error())))
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		backoff = min(2*backoff, retryBackoffMax)
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright (c) 2023 Cisco Systems, Inc. and its affiliates
+// All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http:www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestIsRetryableAndTerminal(t *testing.T) {
+	tests := []struct {
+		name          string
+		err           error
+		wantRetryable bool
+		wantTerminal  bool
+	}{
+		{name: "no error"},
+		{name: "plain error", err: errors.New("failed")},
+		{name: "unavailable", err: status.Error(codes.Unavailable, ""), wantRetryable: true},
+		{name: "deadline exceeded", err: status.Error(codes.DeadlineExceeded, ""), wantRetryable: true},
+		{name: "resource exhausted", err: status.Error(codes.ResourceExhausted, ""), wantRetryable: true},
+		{name: "invalid argument", err: status.Error(codes.InvalidArgument, ""), wantTerminal: true},
+		{name: "not found", err: status.Error(codes.NotFound, ""), wantTerminal: true},
+		{name: "already exists", err: status.Error(codes.AlreadyExists, ""), wantTerminal: true},
+		{name: "internal", err: status.Error(codes.Internal, "")},
+		{name: "unauthenticated", err: status.Error(codes.Unauthenticated, "")},
+		{name: "canceled", err: status.Error(codes.Canceled, "")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsRetryable(tt.err); got != tt.wantRetryable {
+				t.Errorf("IsRetryable() = %v, want %v", got, tt.wantRetryable)
+			}
+			if got := IsTerminal(tt.err); got != tt.wantTerminal {
+				t.Errorf("IsTerminal() = %v, want %v", got, tt.wantTerminal)
+			}
+		})
+	}
+}
+
+// fakeInvoker fails calls with the given errors in turn, then succeeds
+type fakeInvoker struct {
+	errs  []error
+	calls int
+}
+
+func (f *fakeInvoker) invoke(_ context.Context, _ string, _, _ interface{}, _ *grpc.ClientConn,
+	_ ...grpc.CallOption) error {
+	f.calls++
+	if f.calls <= len(f.errs) {
+		return f.errs[f.calls-1]
+	}
+	return nil
+}
+
+func repeatErr(err error, n int) []error {
+	errs := make([]error, n)
+	for i := range errs {
+		errs[i] = err
+	}
+	return errs
+}
+
+func TestRetryInterceptor(t *testing.T) {
+	base, maxBackoff := retryBackoffBase, retryBackoffMax
+	retryBackoffBase, retryBackoffMax = time.Millisecond, 2*time.Millisecond
+	t.Cleanup(func() { retryBackoffBase, retryBackoffMax = base, maxBackoff })
+
+	unavailable := status.Error(codes.Unavailable, "")
+	tests := []struct {
+		name      string
+		method    string
+		errs      []error
+		wantCode  codes.Code
+		wantCalls int
+	}{
+		{name: "success", method: "/ConnectionController/ListConnections", wantCalls: 1},
+		{name: "retried unavailable", method: "/ConnectionController/ListConnections",
+			errs: []error{unavailable}, wantCalls: 2},
+		{name: "retried deadline exceeded", method: "/CloudProviderService/ListVPC",
+			errs: []error{status.Error(codes.DeadlineExceeded, "")}, wantCalls: 2},
+		{name: "retried resource exhausted", method: "/CloudProviderService/ListVPC",
+			errs: []error{status.Error(codes.ResourceExhausted, "")}, wantCalls: 2},
+		{name: "retried idempotent delete", method: "/ConnectionController/Disconnect",
+			errs: repeatErr(unavailable, 2), wantCalls: 3},
+		{name: "retries exhausted", method: "/ConnectionController/ListConnections",
+			errs: repeatErr(unavailable, maxRetries+2), wantCode: codes.Unavailable, wantCalls: maxRetries + 1},
+		{name: "invalid argument", method: "/ConnectionController/ListConnections",
+			errs: []error{status.Error(codes.InvalidArgument, "")}, wantCode: codes.InvalidArgument, wantCalls: 1},
+		{name: "not found", method: "/ConnectionController/GetConnection",
+			errs: []error{status.Error(codes.NotFound, "")}, wantCode: codes.NotFound, wantCalls: 1},
+		{name: "already exists", method: "/ConnectionController/ListConnections",
+			errs: []error{status.Error(codes.AlreadyExists, "")}, wantCode: codes.AlreadyExists, wantCalls: 1},
+		{name: "internal", method: "/ConnectionController/ListConnections",
+			errs: []error{status.Error(codes.Internal, "")}, wantCode: codes.Internal, wantCalls: 1},
+		{name: "connect", method: "/ConnectionController/Connect",
+			errs: []error{unavailable}, wantCode: codes.Unavailable, wantCalls: 1},
+		{name: "connect apps", method: "/AppConnectionController/ConnectApps",
+			errs: []error{unavailable}, wantCode: codes.Unavailable, wantCalls: 1},
+		{name: "create app connection policy", method: "/AppConnectionController/CreateAppConnectionPolicy",
+			errs: []error{unavailable}, wantCode: codes.Unavailable, wantCalls: 1},
+		{name: "create access policy", method: "/SecurityPolicyService/CreateAccessPolicy",
+			errs: []error{status.Error(codes.DeadlineExceeded, "")}, wantCode: codes.DeadlineExceeded, wantCalls: 1},
+		{name: "create network SLA", method: "/NetworkSLAService/CreateNetworkSLA",
+			errs: []error{unavailable}, wantCode: codes.Unavailable, wantCalls: 1},
+	}
+	awiClient := &AwiGrpcClient{logger: logr.Discard()}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			invoker := &fakeInvoker{errs: tt.errs}
+			err := awiClient.retryInterceptor(context.Background(), tt.method, nil, nil, nil, invoker.invoke)
+			if code := status.Code(err); code != tt.wantCode {
+				t.Errorf("retryInterceptor() code = %v, want %v", code, tt.wantCode)
+			}
+			if invoker.calls != tt.wantCalls {
+				t.Errorf("invoker called %d times, want %d", invoker.calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestRetryInterceptorStopsWhenContextIsDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	awiClient := &AwiGrpcClient{logger: logr.Discard()}
+	calls := 0
+	err := awiClient.retryInterceptor(ctx, "/ConnectionController/ListConnections", nil, nil, nil,
+		func(context.Context, string, interface{}, interface{}, *grpc.ClientConn, ...grpc.CallOption) error {
+			calls++
+			cancel()
+			return status.Error(codes.Unavailable, "")
+		})
+	if status.Code(err) != codes.Unavailable || calls != 1 {
+		t.Errorf("retryInterceptor() = %v after %d calls, want Unavailable after 1", err, calls)
+	}
+}
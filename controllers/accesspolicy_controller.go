@@ -0,0 +1,299 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	awiv1alpha1 "app-net-interface.io/kube-awi/api/awi/v1alpha1"
+	awiClient "app-net-interface.io/kube-awi/client"
+	"app-net-interface.io/kube-awi/pkg/connection_status"
+	"app-net-interface.io/kube-awi/pkg/tracing"
+	awipb "github.com/app-net-interface/awi-grpc/pb"
+)
+
+// AccessPolicyStateInvalid is set as the AccessPolicy state when the spec
+// was rejected by the operator and never sent to the AWI server.
+const AccessPolicyStateInvalid = "INVALID"
+
+// AccessPolicyReconciler reconciles a AccessPolicy object
+type AccessPolicyReconciler struct {
+	client.Client
+	Scheme    *runtime.Scheme
+	AwiClient *awiClient.AwiGrpcClient
+	// PollInterval is how often policies IN_PROGRESS are looked up in AWI,
+	// status changes don't trigger reconciliation
+	PollInterval time.Duration
+}
+
+//+kubebuilder:rbac:groups=awi.app-net-interface.io,resources=accesspolicies,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=awi.app-net-interface.io,resources=accesspolicies/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=awi.app-net-interface.io,resources=accesspolicies/finalizers,verbs=update
+
+func (r *AccessPolicyReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	logger.Info("Request received", "req:", req.String())
+
+	var policy awiv1alpha1.AccessPolicy
+
+	if err := r.Get(ctx, req.NamespacedName, &policy); err != nil {
+		logger.Error(err, "unable to fetch AccessPolicy object", "namespace:", req.Namespace, "name:", req.Name)
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	// name of our custom finalizer
+	myFinalizerName := "accesspolicy.awi.app-net-interface.io/finalizer"
+
+	if policy.ObjectMeta.DeletionTimestamp.IsZero() {
+		if !controllerutil.ContainsFinalizer(&policy, myFinalizerName) {
+			controllerutil.AddFinalizer(&policy, myFinalizerName)
+			if err := r.Update(ctx, &policy); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+	} else {
+		logger.Info("AccessPolicy is being deleted", "namespace", req.Namespace, "name", req.Name)
+		if controllerutil.ContainsFinalizer(&policy, myFinalizerName) {
+			// policies which were never accepted don't exist in AWI
+			if policy.Status.PolicyName != "" {
+				policyName := awiAccessPolicyName(policy.GetNamespace(), policy.GetName())
+				if err := r.AwiClient.DeleteAccessPolicyRequest(ctx, policyName); err != nil {
+					logger.Error(err, "Failed to send delete access policy request to AWI server")
+					return ctrl.Result{}, err
+				}
+			}
+
+			controllerutil.RemoveFinalizer(&policy, myFinalizerName)
+			if err := r.Update(ctx, &policy); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		return ctrl.Result{}, nil
+	}
+
+	if err := validateAccessPolicy(&policy.Spec); err != nil {
+		logger.Info("AccessPolicy is invalid", "namespace", req.Namespace, "name", req.Name, "reason", err.Error())
+		return ctrl.Result{}, r.updateStatus(ctx, &policy, awiv1alpha1.AccessPolicyStatus{
+			State:              AccessPolicyStateInvalid,
+			Message:            err.Error(),
+			PolicyName:         policy.Status.PolicyName,
+			ObservedGeneration: policy.Status.ObservedGeneration,
+		})
+	}
+
+	policyName := awiAccessPolicyName(policy.GetNamespace(), policy.GetName())
+	if accessPolicySent(&policy, policyName) {
+		// creating the policy isn't idempotent, so it's sent once per spec
+		// generation, policy in progress is polled by listing it
+		if policy.Status.State != awipb.Status_name[int32(awipb.Status_IN_PROGRESS)] {
+			return ctrl.Result{}, nil
+		}
+		return r.pollAccessPolicy(ctx, &policy)
+	}
+	state, err := r.AwiClient.AccessPolicyRequest(ctx, accessPolicyToProto(&policy, policyName))
+	if err != nil {
+		logger.Error(err, "Failed to send access policy request to AWI server")
+		statusErr := r.updateStatus(ctx, &policy, awiv1alpha1.AccessPolicyStatus{
+			State:              awipb.Status_name[int32(awipb.Status_FAILED)],
+			Message:            err.Error(),
+			PolicyName:         policy.Status.PolicyName,
+			ObservedGeneration: policy.Status.ObservedGeneration,
+		})
+		if statusErr != nil {
+			logger.Error(statusErr, "couldn't update AccessPolicy status")
+		}
+		if awiClient.IsTerminal(err) {
+			// policy rejected by AWI is retried once its spec changes
+			return ctrl.Result{}, reconcile.TerminalError(err)
+		}
+		return ctrl.Result{}, err
+	}
+	err = r.updateStatus(ctx, &policy, awiv1alpha1.AccessPolicyStatus{
+		State:              awipb.Status_name[int32(state)],
+		PolicyName:         policyName,
+		ObservedGeneration: policy.GetGeneration(),
+	})
+	if err != nil || state != awipb.Status_IN_PROGRESS {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: r.pollInterval()}, nil
+}
+
+// accessPolicySent checks if the current spec was already accepted by AWI
+// under the given name, so the create request mustn't be sent again
+func accessPolicySent(policy *awiv1alpha1.AccessPolicy, policyName string) bool {
+	if policy.Status.PolicyName != policyName || policy.Status.ObservedGeneration != policy.GetGeneration() {
+		return false
+	}
+	switch policy.Status.State {
+	case awipb.Status_name[int32(awipb.Status_SUCCESS)], awipb.Status_name[int32(awipb.Status_IN_PROGRESS)]:
+		return true
+	}
+	return false
+}
+
+// pollAccessPolicy checks if the policy in progress was created. AWI can't
+// be asked for the state of a policy, it's settled once AWI lists it.
+func (r *AccessPolicyReconciler) pollAccessPolicy(ctx context.Context, policy *awiv1alpha1.AccessPolicy) (ctrl.Result, error) {
+	policies, err := r.AwiClient.ListAccessPolicies(ctx)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	for _, listed := range policies {
+		if listed.GetMetadata().GetName() == policy.Status.PolicyName {
+			status := policy.Status
+			status.State = awipb.Status_name[int32(awipb.Status_SUCCESS)]
+			return ctrl.Result{}, r.updateStatus(ctx, policy, status)
+		}
+	}
+	return ctrl.Result{RequeueAfter: r.pollInterval()}, nil
+}
+
+func (r *AccessPolicyReconciler) pollInterval() time.Duration {
+	if r.PollInterval <= 0 {
+		return connection_status.DefaultPollInterval
+	}
+	return r.PollInterval
+}
+
+// awiAccessPolicyName returns the name of the policy in AWI, access
+// policies are global there, so the namespace is part of it
+func awiAccessPolicyName(namespace, name string) string {
+	return namespace + "-" + name
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *AccessPolicyReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&awiv1alpha1.AccessPolicy{}).
+		WithEventFilter(predicate.Funcs{
+			UpdateFunc: func(e event.UpdateEvent) bool {
+				// status is written by this reconciler, so only spec changes and
+				// deletion need to be synced with the AWI server
+				return e.ObjectOld.GetGeneration() != e.ObjectNew.GetGeneration() ||
+					!e.ObjectNew.GetDeletionTimestamp().IsZero()
+			},
+			DeleteFunc: func(deleteEvent event.DeleteEvent) bool {
+				// ignore delete events as delete logic is being handled by finalizer
+				return false
+			},
+		}).
+		Complete(tracing.Reconciler("AccessPolicy", r))
+}
+
+func (r *AccessPolicyReconciler) updateStatus(ctx context.Context, policy *awiv1alpha1.AccessPolicy,
+	status awiv1alpha1.AccessPolicyStatus) error {
+	if policy.Status == status {
+		return nil
+	}
+	policy.Status = status
+	return r.Status().Update(ctx, policy)
+}
+
+func validateAccessPolicy(spec *awiv1alpha1.AccessPolicySpec) error {
+	if len(spec.Rules) == 0 {
+		return fmt.Errorf("access policy has no rules")
+	}
+	for i, rule := range spec.Rules {
+		protocol := strings.ToUpper(rule.Protocol)
+		switch protocol {
+		case "TCP", "UDP":
+			if err := validatePortRange(rule.Port); err != nil {
+				return fmt.Errorf("rule %d: %v", i, err)
+			}
+		case "ICMP", "ANY":
+			if rule.Port != "" {
+				return fmt.Errorf("rule %d: port can't be specified for protocol %s", i, protocol)
+			}
+		default:
+			return fmt.Errorf("rule %d: unsupported protocol %q", i, rule.Protocol)
+		}
+	}
+	return nil
+}
+
+// validatePortRange accepts an empty port (any port), a single port
+// or a range in the form "from-to".
+func validatePortRange(port string) error {
+	if port == "" {
+		return nil
+	}
+	from, to, isRange := strings.Cut(port, "-")
+	fromPort, err := parsePort(from)
+	if err != nil {
+		return err
+	}
+	if !isRange {
+		return nil
+	}
+	toPort, err := parsePort(to)
+	if err != nil {
+		return err
+	}
+	if fromPort > toPort {
+		return fmt.Errorf("invalid port range %q", port)
+	}
+	return nil
+}
+
+func parsePort(port string) (int, error) {
+	value, err := strconv.Atoi(strings.TrimSpace(port))
+	if err != nil || value < 1 || value > 65535 {
+		return 0, fmt.Errorf("invalid port %q", port)
+	}
+	return value, nil
+}
+
+func accessPolicyToProto(policy *awiv1alpha1.AccessPolicy, name string) *awipb.Security_AccessPolicy {
+	labels := make(map[string]string, len(policy.GetLabels())+1)
+	for k, v := range policy.GetLabels() {
+		labels[k] = v
+	}
+	// AWI access policy has no notion of direction, so it's passed as a label
+	labels["direction"] = policy.Spec.Direction
+
+	protocols := make([]*awipb.Security_AccessPolicy_AccessProtocol, 0, len(policy.Spec.Rules))
+	for _, rule := range policy.Spec.Rules {
+		protocols = append(protocols, &awipb.Security_AccessPolicy_AccessProtocol{
+			Protocol: strings.ToUpper(rule.Protocol),
+			Port:     rule.Port,
+		})
+	}
+	return &awipb.Security_AccessPolicy{
+		Metadata: &awipb.Security_PolicyMetadata{
+			Name:        name,
+			Description: policy.Spec.Description,
+			Labels:      labels,
+		},
+		AccessProtocols: protocols,
+		AccessType:      policy.Spec.AccessType,
+		Priority:        policy.Spec.Priority,
+	}
+}
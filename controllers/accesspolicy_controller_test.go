@@ -0,0 +1,219 @@
+// Copyright (c) 2023 Cisco Systems, Inc. and its affiliates
+// All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http:www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+// +kubebuilder:docs-gen:collapse=Apache License
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	awiv1alpha1 "app-net-interface.io/kube-awi/api/awi/v1alpha1"
+	awiMock "github.com/app-net-interface/awi-grpc/mocks"
+	awi "github.com/app-net-interface/awi-grpc/pb"
+)
+
+var _ = Describe("AccessPolicy Controller", func() {
+	const (
+		namespace = "default"
+		timeout   = 10 * time.Second
+		interval  = 250 * time.Millisecond
+	)
+
+	It("should send access policy to grpc server and remove it when CRD is deleted", func() {
+		const policyName = "access-policy-web"
+
+		t := GinkgoT()
+		mockSecurityPolicyClient := awiMock.NewSecurityPolicyServiceClient(t)
+		defer mockSecurityPolicyClient.AssertExpectations(t)
+		awiTestClient.SecurityPolicyClient = mockSecurityPolicyClient
+
+		mockSecurityPolicyClient.EXPECT().
+			CreateAccessPolicy(mock.Anything, mock.Anything).
+			Run(func(_ context.Context, req *awi.AccessPolicyCreateRequest, _ ...grpc.CallOption) {
+				Expect(req.GetAccessPolicy().GetMetadata().GetName()).To(Equal(namespace + "-" + policyName))
+				Expect(req.GetAccessPolicy().GetMetadata().GetLabels()).To(HaveKeyWithValue("direction", "EGRESS"))
+				Expect(req.GetAccessPolicy().GetAccessProtocols()).To(HaveLen(1))
+				Expect(req.GetAccessPolicy().GetAccessProtocols()[0].GetPort()).To(Equal("443"))
+			}).
+			Return(&awi.AccessPolicyCreateResponse{Status: awi.Status_SUCCESS}, nil)
+
+		policy := &awiv1alpha1.AccessPolicy{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "awi.app-net-interface.io/v1alpha1", Kind: "AccessPolicy"},
+			ObjectMeta: metav1.ObjectMeta{Name: policyName, Namespace: namespace},
+			Spec: awiv1alpha1.AccessPolicySpec{
+				AccessType: "ALLOW",
+				Direction:  "EGRESS",
+				Rules: []awiv1alpha1.AccessPolicyRule{
+					{Protocol: "TCP", Port: "443"},
+				},
+			},
+		}
+		Expect(k8sClient.Create(ctx, policy)).Should(Succeed())
+
+		lookupKey := types.NamespacedName{Name: policyName, Namespace: namespace}
+		Eventually(func() string {
+			policyObj := &awiv1alpha1.AccessPolicy{}
+			if err := k8sClient.Get(ctx, lookupKey, policyObj); err != nil {
+				return ""
+			}
+			return policyObj.Status.State
+		}, timeout, interval).Should(Equal("SUCCESS"))
+
+		By("removing object delete request should be sent")
+		delCtx, delCanc := context.WithCancel(context.Background())
+		mockSecurityPolicyClient.EXPECT().
+			DeleteAccessPolicy(mock.Anything, &awi.AccessPolicyDeleteRequest{Name: namespace + "-" + policyName}).
+			Run(func(_ context.Context, _ *awi.AccessPolicyDeleteRequest, _ ...grpc.CallOption) {
+				delCanc()
+			}).
+			Return(&awi.AccessPolicyDeleteResponse{}, nil)
+		Expect(k8sClient.Delete(ctx, policy)).Should(Succeed())
+		select {
+		case <-delCtx.Done():
+		case <-time.After(5 * time.Second):
+			t.Errorf("Deadline for delete call to mock security policy client exceeded")
+		}
+	})
+
+	It("should poll access policy until it's listed without creating it again", func() {
+		const policyName = "access-policy-pending"
+
+		t := GinkgoT()
+		mockSecurityPolicyClient := awiMock.NewSecurityPolicyServiceClient(t)
+		awiTestClient.SecurityPolicyClient = mockSecurityPolicyClient
+		// creating the policy isn't idempotent, it's sent once
+		mockSecurityPolicyClient.EXPECT().
+			CreateAccessPolicy(mock.Anything, mock.Anything).
+			Return(&awi.AccessPolicyCreateResponse{Status: awi.Status_IN_PROGRESS}, nil).
+			Once()
+		mockSecurityPolicyClient.EXPECT().
+			ListAccessPolicies(mock.Anything, mock.Anything).
+			Return(&awi.AccessPolicyListResponse{}, nil).
+			Once()
+		mockSecurityPolicyClient.EXPECT().
+			ListAccessPolicies(mock.Anything, mock.Anything).
+			Return(&awi.AccessPolicyListResponse{
+				AccessPolicies: []*awi.Security_AccessPolicy{{
+					Metadata: &awi.Security_PolicyMetadata{Name: awiAccessPolicyName(namespace, policyName)},
+				}},
+			}, nil)
+
+		policy := &awiv1alpha1.AccessPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: policyName, Namespace: namespace},
+			Spec: awiv1alpha1.AccessPolicySpec{
+				AccessType: "ALLOW",
+				Direction:  "EGRESS",
+				Rules: []awiv1alpha1.AccessPolicyRule{
+					{Protocol: "ANY"},
+				},
+			},
+		}
+		Expect(k8sClient.Create(ctx, policy)).Should(Succeed())
+
+		lookupKey := types.NamespacedName{Name: policyName, Namespace: namespace}
+		Eventually(func() string {
+			policyObj := &awiv1alpha1.AccessPolicy{}
+			if err := k8sClient.Get(ctx, lookupKey, policyObj); err != nil {
+				return ""
+			}
+			return policyObj.Status.State
+		}, timeout, interval).Should(Equal("SUCCESS"))
+		mockSecurityPolicyClient.AssertNumberOfCalls(t, "CreateAccessPolicy", 1)
+
+		mockSecurityPolicyClient.EXPECT().
+			DeleteAccessPolicy(mock.Anything, mock.Anything).
+			Return(&awi.AccessPolicyDeleteResponse{}, nil).
+			Maybe()
+		Expect(k8sClient.Delete(ctx, policy)).Should(Succeed())
+		Eventually(func() bool {
+			err := k8sClient.Get(ctx, lookupKey, &awiv1alpha1.AccessPolicy{})
+			return apierrors.IsNotFound(err)
+		}, timeout, interval).Should(BeTrue())
+	})
+
+	It("should mark access policy with port for ICMP as invalid without calling grpc server", func() {
+		const policyName = "access-policy-icmp"
+
+		t := GinkgoT()
+		mockSecurityPolicyClient := awiMock.NewSecurityPolicyServiceClient(t)
+		defer mockSecurityPolicyClient.AssertExpectations(t)
+		awiTestClient.SecurityPolicyClient = mockSecurityPolicyClient
+
+		policy := &awiv1alpha1.AccessPolicy{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "awi.app-net-interface.io/v1alpha1", Kind: "AccessPolicy"},
+			ObjectMeta: metav1.ObjectMeta{Name: policyName, Namespace: namespace},
+			Spec: awiv1alpha1.AccessPolicySpec{
+				AccessType: "DENY",
+				Direction:  "INGRESS",
+				Rules: []awiv1alpha1.AccessPolicyRule{
+					{Protocol: "ICMP", Port: "8"},
+				},
+			},
+		}
+		Expect(k8sClient.Create(ctx, policy)).Should(Succeed())
+
+		lookupKey := types.NamespacedName{Name: policyName, Namespace: namespace}
+		Eventually(func() string {
+			policyObj := &awiv1alpha1.AccessPolicy{}
+			if err := k8sClient.Get(ctx, lookupKey, policyObj); err != nil {
+				return ""
+			}
+			return policyObj.Status.State
+		}, timeout, interval).Should(Equal(AccessPolicyStateInvalid))
+
+		Expect(k8sClient.Delete(ctx, policy)).Should(Succeed())
+	})
+})
+
+var _ = Describe("AccessPolicy validation", func() {
+	It("should accept valid port ranges", func() {
+		Expect(validatePortRange("")).To(Succeed())
+		Expect(validatePortRange("80")).To(Succeed())
+		Expect(validatePortRange("8000-8080")).To(Succeed())
+	})
+
+	It("should reject invalid port ranges", func() {
+		Expect(validatePortRange("0")).NotTo(Succeed())
+		Expect(validatePortRange("70000")).NotTo(Succeed())
+		Expect(validatePortRange("http")).NotTo(Succeed())
+		Expect(validatePortRange("8080-8000")).NotTo(Succeed())
+	})
+})
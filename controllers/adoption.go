@@ -0,0 +1,135 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"google.golang.org/protobuf/proto"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	awiv1alpha1 "app-net-interface.io/kube-awi/api/awi/v1alpha1"
+	awiClient "app-net-interface.io/kube-awi/client"
+	awipb "github.com/app-net-interface/awi-grpc/pb"
+)
+
+// adoptedConnectionId returns ID of the existing AWI connection the object
+// should take over, instead of creating a new one
+func adoptedConnectionId(obj client.Object) string {
+	return obj.GetAnnotations()[awiv1alpha1.AdoptedConnectionIdAnnotation]
+}
+
+// retainsConnection checks if the AWI connection should be left in place
+// when the object is deleted. The deletion-policy annotation takes
+// precedence over deletionPolicy from the spec.
+func retainsConnection(obj client.Object, policy string) bool {
+	if annotated, ok := obj.GetAnnotations()[awiv1alpha1.DeletionPolicyAnnotation]; ok {
+		policy = annotated
+	}
+	return policy == awiv1alpha1.DeletionPolicyRetain
+}
+
+// setOwnerLabels tags AWI metadata labels with the identity of the object,
+// so connections created by the operator can be told apart and the ones
+// left without an object can be found.
+func setOwnerLabels(labels map[string]string, obj client.Object, clusterName string) {
+	labels[awiClient.OwnerClusterLabel] = clusterName
+	labels[awiClient.OwnerNamespaceLabel] = obj.GetNamespace()
+	labels[awiClient.OwnerNameLabel] = obj.GetName()
+	labels[awiClient.OwnerUIDLabel] = string(obj.GetUID())
+}
+
+// appConnectionWithIdentity returns a copy of the app connection with
+// identity of the CRD in AWI metadata, so app connections with the same
+// name from different namespaces can be told apart.
+func appConnectionWithIdentity(conn *awiv1alpha1.InterNetworkDomainAppConnection, clusterName string) *awipb.AppConnection {
+	appConnection := proto.Clone(&conn.Spec.AppConnection).(*awipb.AppConnection)
+	if appConnection.Metadata == nil {
+		appConnection.Metadata = &awipb.AppMetadata{}
+	}
+	if appConnection.Metadata.Label == nil {
+		appConnection.Metadata.Label = map[string]string{}
+	}
+	setOwnerLabels(appConnection.Metadata.Label, conn, clusterName)
+	// access policies are referenced by the name of the object in the same
+	// namespace, in AWI they're prefixed with the namespace
+	if matchName := appConnection.GetAccessPolicy().GetSelector().GetMatchName(); matchName.GetName() != "" {
+		matchName.Name = awiAccessPolicyName(conn.GetNamespace(), matchName.GetName())
+	}
+	return appConnection
+}
+
+// connectionWithIdentity returns a copy of the connection with identity
+// of the CRD in AWI metadata
+func connectionWithIdentity(conn *awiv1alpha1.InterNetworkDomainConnection, clusterName string) *awipb.ConnectionRequest {
+	connection := proto.Clone(&conn.Spec.ConnectionRequest).(*awipb.ConnectionRequest)
+	if connection.Metadata == nil {
+		connection.Metadata = &awipb.ConnectionMetadata{}
+	}
+	if connection.Metadata.Labels == nil {
+		connection.Metadata.Labels = map[string]string{}
+	}
+	setOwnerLabels(connection.Metadata.Labels, conn, clusterName)
+	return connection
+}
+
+// existingConnectionId returns the ID of the connection created in AWI for
+// the object without stored ID, or an empty string if there is none. The
+// connection could have been created by an older version of the operator,
+// which didn't store IDs, or by a request whose response was lost. Ones
+// created by the operator are matched by owner UID, older ones by spec.
+func existingConnectionId(ctx context.Context, awi *awiClient.AwiGrpcClient,
+	conn *awiv1alpha1.InterNetworkDomainConnection) (string, error) {
+	connections, err := awi.ListConnections(ctx)
+	if err != nil {
+		return "", err
+	}
+	for _, existing := range connections {
+		if uid, ok := existing.GetMetadata().GetLabels()[awiClient.OwnerUIDLabel]; ok {
+			if uid == string(conn.GetUID()) {
+				return existing.GetId(), nil
+			}
+			continue
+		}
+		if awiClient.MatchesConnection(existing, &conn.Spec.ConnectionRequest) {
+			return existing.GetId(), nil
+		}
+	}
+	return "", nil
+}
+
+// existingAppConnectionId is existingConnectionId for app connections
+func existingAppConnectionId(ctx context.Context, awi *awiClient.AwiGrpcClient,
+	conn *awiv1alpha1.InterNetworkDomainAppConnection) (string, error) {
+	appConnections, err := awi.ListAppConnections(ctx)
+	if err != nil {
+		return "", err
+	}
+	for _, existing := range appConnections {
+		config := existing.GetAppConnectionConfig()
+		if uid, ok := config.GetMetadata().GetLabel()[awiClient.OwnerUIDLabel]; ok {
+			if uid == string(conn.GetUID()) {
+				return existing.GetId(), nil
+			}
+			continue
+		}
+		if awiClient.MatchesAppConnection(config, &conn.Spec.AppConnection) {
+			return existing.GetId(), nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	awiv1alpha1 "app-net-interface.io/kube-awi/api/awi/v1alpha1"
+	awipb "github.com/app-net-interface/awi-grpc/pb"
+)
+
+// DefaultDriftCheckInterval is how often connections created in AWI are
+// checked and re-issued if they went missing or failed
+const DefaultDriftCheckInterval = 5 * time.Minute
+
+const (
+	reconnectBackoffBase = 30 * time.Second
+	reconnectBackoffMax  = 30 * time.Minute
+)
+
+// drifted checks if the connection stored in status has to be re-issued.
+// The state is set by the status watcher from AWI, it's MISSING if AWI
+// doesn't know the connection anymore. FAILED along with the terminal error
+// condition is set for the request rejected by AWI, not reported by it.
+func drifted(state string, conditions []metav1.Condition) bool {
+	switch state {
+	case awiv1alpha1.StateMissing:
+		return true
+	case awipb.Status_name[int32(awipb.Status_FAILED)]:
+		return !meta.IsStatusConditionTrue(conditions, awiv1alpha1.ConditionTerminalError)
+	}
+	return false
+}
+
+// reconnectBackoff returns the minimal time between the given attempt and
+// the next one, it doubles with each attempt
+func reconnectBackoff(attempts int32) time.Duration {
+	backoff := reconnectBackoffBase
+	for i := int32(1); i < attempts && backoff < reconnectBackoffMax; i++ {
+		backoff *= 2
+	}
+	if backoff > reconnectBackoffMax {
+		backoff = reconnectBackoffMax
+	}
+	return backoff
+}
+
+// reconnectWait returns how long the next reconnect has to wait for
+func reconnectWait(status *awiv1alpha1.DriftStatus) time.Duration {
+	if status.ReconnectAttempts == 0 || status.LastReconnectTime == nil {
+		return 0
+	}
+	return reconnectBackoff(status.ReconnectAttempts) - time.Since(status.LastReconnectTime.Time)
+}
+
+// recordReconnect records the attempt of re-issuing the connection
+func recordReconnect(status *awiv1alpha1.DriftStatus) {
+	now := metav1.Now()
+	status.ReconnectAttempts++
+	status.LastReconnectTime = &now
+}
+
+// resetReconnects clears attempts once the connection works again, it
+// returns true if status was changed
+func resetReconnects(status *awiv1alpha1.DriftStatus, state string) bool {
+	if state != awipb.Status_name[int32(awipb.Status_SUCCESS)] || status.ReconnectAttempts == 0 {
+		return false
+	}
+	*status = awiv1alpha1.DriftStatus{}
+	return true
+}
@@ -0,0 +1,182 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
+
+	awiv1alpha1 "app-net-interface.io/kube-awi/api/awi/v1alpha1"
+	awipb "github.com/app-net-interface/awi-grpc/pb"
+)
+
+// GatewayServiceType is the k8sService.serviceType of app connections
+// targeting a Gateway API Gateway selected by name and namespace
+const GatewayServiceType = "gateway"
+
+// gatewayPendingRequeue is how long app connection waits before checking
+// again if its Gateway got addresses assigned
+const gatewayPendingRequeue = 10 * time.Second
+
+// equalGatewayEndpoints compares endpoints, addresses and ports are sorted
+func equalGatewayEndpoints(a, b *awiv1alpha1.GatewayEndpoint) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return slices.Equal(a.Addresses, b.Addresses) && slices.Equal(a.Ports, b.Ports)
+}
+
+func isGatewayService(appConnection *awipb.AppConnection) bool {
+	return strings.EqualFold(appConnection.GetTo().GetService().GetKind().GetK8SService().GetServiceType(),
+		GatewayServiceType)
+}
+
+// gatewayKey returns the Gateway selected by the app connection, the
+// namespace of the app connection is used if the selector doesn't have one
+func gatewayKey(conn *awiv1alpha1.InterNetworkDomainAppConnection) types.NamespacedName {
+	selector := conn.Spec.AppConnection.GetTo().GetService().GetSelector()
+	key := types.NamespacedName{
+		Namespace: selector.GetMatchNamespace().GetName(),
+		Name:      selector.GetMatchName().GetName(),
+	}
+	if key.Namespace == "" {
+		key.Namespace = conn.GetNamespace()
+	}
+	return key
+}
+
+// resolveGatewayEndpoint reads addresses and listener ports of the Gateway
+// selected by the app connection. It returns a non-empty reason if the Gateway
+// can't be used yet.
+func resolveGatewayEndpoint(ctx context.Context, k8sClient client.Client,
+	conn *awiv1alpha1.InterNetworkDomainAppConnection) (*awiv1alpha1.GatewayEndpoint, string, error) {
+	key := gatewayKey(conn)
+	if key.Name == "" {
+		return nil, "gateway service requires selector.matchName", nil
+	}
+	var gateway gatewayv1.Gateway
+	err := k8sClient.Get(ctx, key, &gateway)
+	if apierrors.IsNotFound(err) || meta.IsNoMatchError(err) {
+		return nil, fmt.Sprintf("gateway %s not found", key), nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	endpoint := gatewayEndpointOf(&gateway)
+	if len(endpoint.Addresses) == 0 {
+		return nil, fmt.Sprintf("gateway %s has no addresses assigned", key), nil
+	}
+	return endpoint, "", nil
+}
+
+func gatewayEndpointOf(gateway *gatewayv1.Gateway) *awiv1alpha1.GatewayEndpoint {
+	endpoint := &awiv1alpha1.GatewayEndpoint{}
+	addresses := map[string]struct{}{}
+	for _, address := range gateway.Status.Addresses {
+		if _, ok := addresses[address.Value]; ok || address.Value == "" {
+			continue
+		}
+		addresses[address.Value] = struct{}{}
+		endpoint.Addresses = append(endpoint.Addresses, address.Value)
+	}
+	ports := map[int32]struct{}{}
+	for _, listener := range gateway.Spec.Listeners {
+		port := int32(listener.Port)
+		if _, ok := ports[port]; ok {
+			continue
+		}
+		ports[port] = struct{}{}
+		endpoint.Ports = append(endpoint.Ports, port)
+	}
+	sort.Strings(endpoint.Addresses)
+	sort.Slice(endpoint.Ports, func(i, j int) bool { return endpoint.Ports[i] < endpoint.Ports[j] })
+	return endpoint
+}
+
+// gatewayAppConnection returns a copy of the app connection targeting
+// the resolved Gateway endpoint. AWI selects a service by a single host IP
+// and has no field for ports, so the first IP address (or the first
+// hostname if there are none) is used there. All addresses and ports are
+// passed as labels, which AWI doesn't match by.
+func gatewayAppConnection(appConnection *awipb.AppConnection, endpoint *awiv1alpha1.GatewayEndpoint) *awipb.AppConnection {
+	resolved := proto.Clone(appConnection).(*awipb.AppConnection)
+	host := endpoint.Addresses[0]
+	if i := slices.IndexFunc(endpoint.Addresses, func(address string) bool {
+		return net.ParseIP(address) != nil
+	}); i >= 0 {
+		host = endpoint.Addresses[i]
+	}
+	resolved.GetTo().GetService().GetSelector().MatchHost = &awipb.MatchHost{Ip: host}
+
+	if resolved.Metadata == nil {
+		resolved.Metadata = &awipb.AppMetadata{}
+	}
+	if resolved.Metadata.Label == nil {
+		resolved.Metadata.Label = map[string]string{}
+	}
+	ports := make([]string, 0, len(endpoint.Ports))
+	for _, port := range endpoint.Ports {
+		ports = append(ports, strconv.Itoa(int(port)))
+	}
+	resolved.Metadata.Label["gateway-addresses"] = strings.Join(endpoint.Addresses, ",")
+	resolved.Metadata.Label["gateway-ports"] = strings.Join(ports, ",")
+	return resolved
+}
+
+// gatewayAPIAvailable checks if Gateway API CRDs are installed, Gateways
+// can't be watched otherwise
+func gatewayAPIAvailable(mapper meta.RESTMapper) bool {
+	_, err := mapper.RESTMapping(schema.GroupKind{Group: gatewayv1.GroupName, Kind: "Gateway"},
+		gatewayv1.GroupVersion.Version)
+	return err == nil
+}
+
+// appConnectionsForGateway enqueues app connections targeting the Gateway,
+// so they're updated when Gateway addresses or listeners change.
+func (r *AppConnectionReconciler) appConnectionsForGateway(ctx context.Context, gateway client.Object) []reconcile.Request {
+	var connList awiv1alpha1.InterNetworkDomainAppConnectionList
+	if err := r.List(ctx, &connList); err != nil {
+		log.FromContext(ctx).Error(err, "failed to list InterNetworkDomainAppConnection CRDs")
+		return nil
+	}
+	var requests []reconcile.Request
+	for i := range connList.Items {
+		conn := &connList.Items[i]
+		if !isGatewayService(&conn.Spec.AppConnection) ||
+			gatewayKey(conn) != client.ObjectKeyFromObject(gateway) {
+			continue
+		}
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(conn)})
+	}
+	return requests
+}
@@ -18,32 +18,61 @@ package controllers
 
 import (
 	"context"
+	"fmt"
+	"slices"
 	"strings"
+	"time"
 
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
 
 	awiv1alpha1 "app-net-interface.io/kube-awi/api/awi/v1alpha1"
 	awiClient "app-net-interface.io/kube-awi/client"
+	"app-net-interface.io/kube-awi/pkg/connection_status"
+	"app-net-interface.io/kube-awi/pkg/tracing"
 	awipb "github.com/app-net-interface/awi-grpc/pb"
 )
 
+// accessPolicyPendingRequeue is how long app connection waits before checking
+// again if its access policy was accepted by AWI
+const accessPolicyPendingRequeue = 10 * time.Second
+
 // AppConnectionReconciler reconciles a InterNetworkDomainAppConnection object
 type AppConnectionReconciler struct {
 	client.Client
 	Scheme      *runtime.Scheme
 	AwiClient   *awiClient.AwiGrpcClient
 	ClusterName string
+	Recorder    record.EventRecorder
+	// EndpointsDebounce is the minimal time between updates of resolved
+	// pod endpoints of a single app connection
+	EndpointsDebounce time.Duration
+	// DriftCheckInterval is how often the app connection is checked in AWI
+	// and re-issued if it went missing or failed, zero disables the checks
+	DriftCheckInterval time.Duration
 }
 
 //+kubebuilder:rbac:groups=awi.app-net-interface.io,resources=internetworkdomainappconnections,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=awi.app-net-interface.io,resources=internetworkdomainappconnections/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=awi.app-net-interface.io,resources=internetworkdomainappconnections/finalizers,verbs=update
+//+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+//+kubebuilder:rbac:groups=awi.app-net-interface.io,resources=accesspolicies,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch
+//+kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=gateways,verbs=get;list;watch
 
 func (r *AppConnectionReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	logger := log.FromContext(ctx)
@@ -63,6 +92,21 @@ func (r *AppConnectionReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 	// name of our custom finalizer
 	myFinalizerName := "internetworkdomainappconnection.awi.app-net-interface.io/finalizer"
 
+	if setSuspendedCondition(&conn.Status.Conditions, conn.IsSuspended(), conn.GetGeneration()) {
+		if err := r.Status().Update(ctx, &conn); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	if conn.IsSuspended() {
+		// no AWI calls are made while suspended, deletion waits until resumed
+		logger.Info("Reconciliation of InterNetworkDomainAppConnection is suspended", "namespace", req.Namespace, "name", req.Name)
+		return ctrl.Result{}, nil
+	}
+
+	// objects which already had the finalizer could have been connected
+	// without storing the ID, by an older version or by a lost response
+	findExisting := controllerutil.ContainsFinalizer(&conn, myFinalizerName) && conn.Status.ConnectionId == ""
+
 	// examine DeletionTimestamp to determine if object is under deletion
 	if conn.ObjectMeta.DeletionTimestamp.IsZero() {
 		// The object is not being deleted, so if it does not have our finalizer,
@@ -79,11 +123,24 @@ func (r *AppConnectionReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 		logger.Info("InterNetworkDomainAppConnection is being deleted", "namespace", req.Namespace, "name", req.Name)
 		if controllerutil.ContainsFinalizer(&conn, myFinalizerName) {
 			// our finalizer is present, so lets handle any external dependency
-			if err := r.removeAppConnection(&conn); err != nil {
+			if err := r.removeReplacedAppConnection(ctx, &conn); err != nil {
+				logger.Error(err, "Failed to send app disconnect request of replaced app connection to AWI server")
+				return deletionErrorResult(ctx, r.Client, &conn, &conn.Status.Conditions, err)
+			}
+			if retainsConnection(&conn, conn.Spec.DeletionPolicy) {
+				logger.Info("Retaining app connection in AWI", "id", conn.Status.ConnectionId)
+				err := connection_status.RecordRetainedConnection(ctx, r.Client, &conn, conn.Status.ConnectionId)
+				if err != nil {
+					logger.Error(err, "Failed to record retained app connection")
+					return ctrl.Result{}, err
+				}
+				r.Recorder.Eventf(&conn, corev1.EventTypeNormal, "Retained",
+					"App connection %s was left in AWI", conn.Status.ConnectionId)
+			} else if err := r.removeAppConnection(ctx, &conn); err != nil {
 				// if fail to disconnect here, return with error
 				// so that it can be retried
 				logger.Error(err, "Failed to send app disconnect request to AWI server")
-				return ctrl.Result{}, err
+				return deletionErrorResult(ctx, r.Client, &conn, &conn.Status.Conditions, err)
 			}
 
 			// remove our finalizer from the list and update it.
@@ -97,6 +154,22 @@ func (r *AppConnectionReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 		return ctrl.Result{}, nil
 	}
 
+	if adoptedId := adoptedConnectionId(&conn); adoptedId != "" && conn.Status.ConnectionId == "" {
+		logger.Info("Adopting existing app connection", "id", adoptedId)
+		conn.Status.ConnectionId = adoptedId
+		return ctrl.Result{}, r.Status().Update(ctx, &conn)
+	}
+	if adoptedConnectionId(&conn) != "" {
+		// adopted app connection is left as it was created outside of
+		// Kubernetes, endpoints aren't resolved and it's never recreated
+		return ctrl.Result{}, nil
+	}
+	// removal of the replaced app connection failed in one of previous reconciliations
+	if err := r.removeReplacedAppConnection(ctx, &conn); err != nil {
+		logger.Error(err, "Failed to send app disconnect request of replaced app connection to AWI server")
+		return ctrl.Result{}, err
+	}
+
 	// add information about source cluster if it's not provided
 	if conn.Spec.AppConnection.GetFrom().GetEndpoint() != nil &&
 		strings.ToLower(conn.Spec.AppConnection.GetFrom().GetEndpoint().GetKind()) == "pod" &&
@@ -105,32 +178,292 @@ func (r *AppConnectionReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 			Name: r.ClusterName,
 		}
 	}
-	err := r.AwiClient.AppConnectionRequest(&conn.Spec.AppConnection)
+
+	pending, reason, err := r.checkAccessPolicy(ctx, &conn)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if pending {
+		logger.Info("Waiting for access policy to be accepted by AWI", "reason", reason)
+		return ctrl.Result{RequeueAfter: accessPolicyPendingRequeue}, nil
+	}
+	if reason != "" {
+		logger.Info("InterNetworkDomainAppConnection can't be created", "reason", reason)
+		return ctrl.Result{}, r.updateStatus(ctx, &conn, awipb.Status_name[int32(awipb.Status_FAILED)])
+	}
+
+	if findExisting {
+		// the status watcher migrates such objects as well, but it runs
+		// only after the reconcilers started
+		existingId, err := existingAppConnectionId(ctx, r.AwiClient, &conn)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if existingId != "" {
+			logger.Info("Found app connection created without stored ID", "id", existingId)
+			conn.Status.ConnectionId = existingId
+			if err := r.Status().Update(ctx, &conn); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+	}
+
+	// app connection missing or failed in AWI is re-issued with backoff
+	reconnect, replace := false, false
+	if conn.Status.ConnectionId != "" && r.DriftCheckInterval > 0 {
+		// state in AWI is tracked by the status watcher
+		if drifted(conn.Status.State, conn.Status.Conditions) {
+			if wait := reconnectWait(&conn.Status.DriftStatus); wait > 0 {
+				return ctrl.Result{RequeueAfter: wait}, nil
+			}
+			logger.Info("Re-issuing app connection missing or failed in AWI", "id", conn.Status.ConnectionId,
+				"state", conn.Status.State, "attempts", conn.Status.ReconnectAttempts)
+			reconnect, replace = true, conn.Status.State != awiv1alpha1.StateMissing
+		} else if resetReconnects(&conn.Status.DriftStatus, conn.Status.State) {
+			if err := r.Status().Update(ctx, &conn); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+	}
+
+	if conn.Status.ConnectionId != "" && !reconnect && !isGatewayService(&conn.Spec.AppConnection) {
+		if _, _, ok := podSelectorOf(&conn, r.ClusterName); !ok {
+			// app connection was already created in AWI and it can't be updated
+			return ctrl.Result{RequeueAfter: r.DriftCheckInterval}, nil
+		}
+	}
+
+	// endpoints resolved from the local cluster are recorded once sent to AWI,
+	// app connection can't be updated, so it's recreated whenever they change
+	appConnection := appConnectionWithIdentity(&conn, r.ClusterName)
+	resolvesEndpoints, upToDate, connected := false, true, conn.Status.ConnectionId != ""
+
+	var endpoint *awiv1alpha1.GatewayEndpoint
+	if isGatewayService(appConnection) {
+		var reason string
+		endpoint, reason, err = resolveGatewayEndpoint(ctx, r.Client, &conn)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if reason != "" {
+			logger.Info("Waiting for gateway to be ready", "reason", reason)
+			return ctrl.Result{RequeueAfter: gatewayPendingRequeue}, nil
+		}
+		previous := conn.Status.GatewayEndpoint
+		resolvesEndpoints, connected = true, connected || previous != nil
+		if !equalGatewayEndpoints(previous, endpoint) {
+			logger.Info("Gateway endpoint changed", "previous", previous, "current", endpoint)
+			upToDate = false
+		}
+		appConnection = gatewayAppConnection(appConnection, endpoint)
+	}
+
+	namespace, selector, resolvesPods := podSelectorOf(&conn, r.ClusterName)
+	var podIPs []string
+	if resolvesPods {
+		podIPs, err = resolvePodEndpoints(ctx, r.Client, namespace, selector)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if len(podIPs) == 0 {
+			// there is nothing to match in AWI, pod events requeue the
+			// app connection, the one already created is kept meanwhile
+			logger.Info("Waiting for running pods selected by from.endpoint")
+			return ctrl.Result{}, nil
+		}
+		lastUpdate := conn.Status.EndpointsUpdateTime
+		resolvesEndpoints, connected = true, connected || lastUpdate != nil
+		if lastUpdate == nil || !slices.Equal(podIPs, conn.Status.ResolvedEndpoints) {
+			if lastUpdate != nil {
+				if wait := r.EndpointsDebounce - time.Since(lastUpdate.Time); wait > 0 {
+					logger.Info("Delaying update of resolved pod endpoints", "after", wait)
+					return ctrl.Result{RequeueAfter: wait}, nil
+				}
+			}
+			logger.Info("Resolved pod endpoints changed", "previous", conn.Status.ResolvedEndpoints, "current", podIPs)
+			upToDate = false
+		}
+		appConnection = podEndpointsAppConnection(appConnection, podIPs)
+	}
+
+	if resolvesEndpoints && upToDate && !reconnect {
+		return ctrl.Result{RequeueAfter: r.DriftCheckInterval}, nil
+	}
+	// the previous app connection is removed once the new one was requested,
+	// so traffic isn't cut off meanwhile, app connection missing in AWI can't
+	// be disconnected
+	if (resolvesEndpoints && connected && !reconnect) || replace {
+		if conn.Status.ConnectionId == "" {
+			// app connection without stored ID is found by spec, which
+			// would match the new one as well, so it's removed first
+			if err := r.removeAppConnection(ctx, &conn); err != nil {
+				logger.Error(err, "Failed to send app disconnect request to AWI server")
+				return awiErrorResult(ctx, r.Client, &conn, &conn.Status.Conditions, &conn.Status.State, err)
+			}
+		} else {
+			conn.Status.ReplacedConnectionId = conn.Status.ConnectionId
+		}
+	}
+	if reconnect {
+		recordReconnect(&conn.Status.DriftStatus)
+		conn.Status.ConnectionId = ""
+		conn.Status.State = awipb.Status_name[int32(awipb.Status_IN_PROGRESS)]
+		if err := r.Status().Update(ctx, &conn); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	connectionId, err := r.AwiClient.AppConnectionRequest(ctx, appConnection)
 	if err != nil {
 		logger.Error(err, "Failed to send app connection request to awi server")
+		return awiErrorResult(ctx, r.Client, &conn, &conn.Status.Conditions, &conn.Status.State, err)
+	}
+
+	statusChanged := conn.Status.ReplacedConnectionId != ""
+	if endpoint != nil {
+		conn.Status.GatewayEndpoint = endpoint
+		statusChanged = true
+	}
+	if connectionId != "" && connectionId != conn.Status.ConnectionId {
+		conn.Status.ConnectionId = connectionId
+		statusChanged = true
+	}
+	if resolvesPods {
+		now := metav1.Now()
+		conn.Status.ResolvedEndpoints = podIPs
+		conn.Status.EndpointsUpdateTime = &now
+		statusChanged = true
+	}
+	if clearTerminalError(&conn.Status.Conditions) {
+		statusChanged = true
 	}
-	return ctrl.Result{}, err
+	// the connection could have been marked as failed because of missing access
+	// policy or rejected by AWI, status watcher will set the actual state reported by AWI
+	if conn.Status.State == awipb.Status_name[int32(awipb.Status_FAILED)] {
+		conn.Status.State = awipb.Status_name[int32(awipb.Status_IN_PROGRESS)]
+		statusChanged = true
+	}
+	if statusChanged {
+		if err := r.Status().Update(ctx, &conn); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	if err := r.removeReplacedAppConnection(ctx, &conn); err != nil {
+		logger.Error(err, "Failed to send app disconnect request of replaced app connection to AWI server")
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: r.DriftCheckInterval}, nil
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *AppConnectionReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&awiv1alpha1.InterNetworkDomainAppConnection{}).
-		WithEventFilter(predicate.Funcs{
+	bldr := ctrl.NewControllerManagedBy(mgr).
+		For(&awiv1alpha1.InterNetworkDomainAppConnection{}, builder.WithPredicates(predicate.Funcs{
 			UpdateFunc: func(e event.UpdateEvent) bool {
 				// update of app connection is not supported, so we ignore all update events
 				// except for cases when deletion timestamp is not zero, this means object is being deleted, and
-				// we want to call finalizer
-				return !e.ObjectNew.GetDeletionTimestamp().IsZero()
+				// we want to call finalizer, reconciliation is suspended or resumed, or spec
+				// rejected by AWI was changed
+				return !e.ObjectNew.GetDeletionTimestamp().IsZero() || suspendToggled(e) ||
+					changedAfterTerminalError(e)
 			},
 			DeleteFunc: func(deleteEvent event.DeleteEvent) bool {
 				// ignore delete events as delete logic is being handled by finalizer
 				return false
 			},
-		}).
-		Complete(r)
+		})).
+		Watches(&awiv1alpha1.AccessPolicy{},
+			handler.EnqueueRequestsFromMapFunc(r.appConnectionsForAccessPolicy))
+	bldr = bldr.Watches(&corev1.Pod{},
+		handler.EnqueueRequestsFromMapFunc(r.appConnectionsForPod),
+		builder.WithPredicates(podEndpointsChanged))
+	if gatewayAPIAvailable(mgr.GetRESTMapper()) {
+		bldr = bldr.Watches(&gatewayv1.Gateway{},
+			handler.EnqueueRequestsFromMapFunc(r.appConnectionsForGateway))
+	} else {
+		mgr.GetLogger().Info("Gateway API is not installed, gateway app connections won't follow address changes")
+	}
+	return bldr.Complete(tracing.Reconciler("InterNetworkDomainAppConnection", r))
+}
+
+// appConnectionsForAccessPolicy retries app connections which failed because
+// of the given access policy.
+func (r *AppConnectionReconciler) appConnectionsForAccessPolicy(ctx context.Context, policy client.Object) []reconcile.Request {
+	var connList awiv1alpha1.InterNetworkDomainAppConnectionList
+	if err := r.List(ctx, &connList, client.InNamespace(policy.GetNamespace())); err != nil {
+		log.FromContext(ctx).Error(err, "failed to list InterNetworkDomainAppConnection CRDs")
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, conn := range connList.Items {
+		if conn.Spec.AppConnection.GetAccessPolicy().GetSelector().GetMatchName().GetName() != policy.GetName() ||
+			conn.Status.State != awipb.Status_name[int32(awipb.Status_FAILED)] {
+			continue
+		}
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{
+			Namespace: conn.GetNamespace(),
+			Name:      conn.GetName(),
+		}})
+	}
+	return requests
 }
 
-func (r *AppConnectionReconciler) removeAppConnection(conn *awiv1alpha1.InterNetworkDomainAppConnection) error {
-	return r.AwiClient.AppDisconnectRequest(&conn.Spec.AppConnection)
+// checkAccessPolicy verifies the access policy referenced by the app connection.
+// It returns pending if the policy hasn't been accepted by AWI yet, and a non-empty
+// reason if the app connection should be marked as failed.
+func (r *AppConnectionReconciler) checkAccessPolicy(ctx context.Context,
+	conn *awiv1alpha1.InterNetworkDomainAppConnection) (bool, string, error) {
+	policyName := conn.Spec.AppConnection.GetAccessPolicy().GetSelector().GetMatchName().GetName()
+	if policyName == "" {
+		return false, "", nil
+	}
+	var policy awiv1alpha1.AccessPolicy
+	err := r.Get(ctx, types.NamespacedName{Namespace: conn.GetNamespace(), Name: policyName}, &policy)
+	if apierrors.IsNotFound(err) {
+		return false, fmt.Sprintf("access policy %s not found", policyName), nil
+	}
+	if err != nil {
+		return false, "", err
+	}
+	switch policy.Status.State {
+	case awipb.Status_name[int32(awipb.Status_SUCCESS)]:
+		return false, "", nil
+	case "", awipb.Status_name[int32(awipb.Status_IN_PROGRESS)]:
+		return true, fmt.Sprintf("access policy %s is not ready", policyName), nil
+	default:
+		return false, fmt.Sprintf("access policy %s is in %s state: %s",
+			policyName, policy.Status.State, policy.Status.Message), nil
+	}
+}
+
+func (r *AppConnectionReconciler) updateStatus(ctx context.Context,
+	conn *awiv1alpha1.InterNetworkDomainAppConnection, state string) error {
+	if conn.Status.State == state {
+		return nil
+	}
+	conn.Status.State = state
+	return r.Status().Update(ctx, conn)
+}
+
+func (r *AppConnectionReconciler) removeAppConnection(ctx context.Context, conn *awiv1alpha1.InterNetworkDomainAppConnection) error {
+	return r.AwiClient.AppDisconnectRequest(ctx, appConnectionWithIdentity(conn, r.ClusterName), conn.Status.ConnectionId)
+}
+
+// removeReplacedAppConnection removes the app connection replaced by the
+// current one, if there's any, and forgets its ID
+func (r *AppConnectionReconciler) removeReplacedAppConnection(ctx context.Context,
+	conn *awiv1alpha1.InterNetworkDomainAppConnection) error {
+	replacedId := conn.Status.ReplacedConnectionId
+	if replacedId == "" {
+		return nil
+	}
+	// AWI returned no new ID, the previous app connection is still the current one
+	if replacedId != conn.Status.ConnectionId {
+		err := r.AwiClient.AppDisconnectRequest(ctx, appConnectionWithIdentity(conn, r.ClusterName), replacedId)
+		if err != nil {
+			return err
+		}
+	}
+	conn.Status.ReplacedConnectionId = ""
+	return r.Status().Update(ctx, conn)
 }
@@ -35,15 +35,22 @@ package controllers
 
 import (
 	"context"
+	"encoding/json"
+	"sync"
 	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"github.com/stretchr/testify/mock"
 	"google.golang.org/grpc"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
 
 	awiv1alpha1 "app-net-interface.io/kube-awi/api/awi/v1alpha1"
+	awiCl "app-net-interface.io/kube-awi/client"
 	awiMock "github.com/app-net-interface/awi-grpc/mocks"
 	awi "github.com/app-net-interface/awi-grpc/pb"
 )
@@ -169,4 +176,443 @@ var _ = Describe("InterNetworkDomainAppConnection Controller", func() {
 			t.Errorf("Deadline for delete call to mock connection controller exceeded")
 		}
 	})
+
+	It("should disconnect app connection by the ID returned from AWI", func() {
+		const (
+			identifiedAppConnectionName = "appconnection-with-id"
+			appConnectionID             = "app-conn-id-1"
+		)
+
+		t := GinkgoT()
+		// ListConnectedApps is not expected, app connection is not looked up by name
+		mockConnectionController := awiMock.NewAppConnectionControllerClient(t)
+		defer mockConnectionController.AssertExpectations(t)
+		awiTestClient.AppConnectionControllerClient = mockConnectionController
+		mockConnectionController.EXPECT().
+			ConnectApps(mock.Anything, mock.Anything).
+			Run(func(_ context.Context, req *awi.AppConnection, _ ...grpc.CallOption) {
+				Expect(req.GetMetadata().GetLabel()).To(HaveKeyWithValue(awiCl.OwnerNamespaceLabel, namespace))
+				Expect(req.GetMetadata().GetLabel()).To(HaveKey(awiCl.OwnerUIDLabel))
+			}).
+			Return(&awi.AppConnectionResponse{AppConnId: appConnectionID}, nil)
+
+		appConn := &awiv1alpha1.InterNetworkDomainAppConnection{
+			ObjectMeta: metav1.ObjectMeta{Name: identifiedAppConnectionName, Namespace: namespace},
+			Spec: awiv1alpha1.AppConnectionSpec{
+				AppConnection: awi.AppConnection{
+					Metadata: &awi.AppMetadata{Name: identifiedAppConnectionName},
+					NetworkDomainConnection: &awi.NetworkDomainConnection{
+						Selector: &awi.NetworkDomainConnection_Selector{MatchName: clusterConnectionId},
+					},
+				},
+			},
+		}
+		Expect(k8sClient.Create(ctx, appConn)).Should(Succeed())
+
+		lookupKey := types.NamespacedName{Name: identifiedAppConnectionName, Namespace: namespace}
+		Eventually(func() string {
+			connObj := &awiv1alpha1.InterNetworkDomainAppConnection{}
+			if err := k8sClient.Get(ctx, lookupKey, connObj); err != nil {
+				return ""
+			}
+			return connObj.Status.ConnectionId
+		}, 10*time.Second, 250*time.Millisecond).Should(Equal(appConnectionID))
+
+		delCtx, delCanc := context.WithCancel(context.Background())
+		mockConnectionController.EXPECT().
+			DisconnectApps(mock.Anything, mock.Anything).
+			Run(func(_ context.Context, req *awi.AppDisconnectionRequest, _ ...grpc.CallOption) {
+				Expect(req.GetConnectionId()).To(Equal(appConnectionID))
+				delCanc()
+			}).
+			Return(&awi.AppDisconnectionResponse{}, nil)
+		Expect(k8sClient.Delete(ctx, appConn)).Should(Succeed())
+		select {
+		case <-delCtx.Done():
+		case <-time.After(5 * time.Second):
+			t.Errorf("Deadline for delete call to mock connection controller exceeded")
+		}
+	})
+
+	It("should leave app connection in AWI when deletion policy is Retain", func() {
+		const (
+			retainedAppConnectionName = "appconnection-retained"
+			appConnectionID           = "app-conn-id-retained"
+		)
+
+		t := GinkgoT()
+		// DisconnectApps is not expected, app connection is retained
+		mockConnectionController := awiMock.NewAppConnectionControllerClient(t)
+		defer mockConnectionController.AssertExpectations(t)
+		awiTestClient.AppConnectionControllerClient = mockConnectionController
+		mockConnectionController.EXPECT().
+			ConnectApps(mock.Anything, mock.Anything).
+			Return(&awi.AppConnectionResponse{AppConnId: appConnectionID}, nil)
+
+		appConn := &awiv1alpha1.InterNetworkDomainAppConnection{
+			ObjectMeta: metav1.ObjectMeta{Name: retainedAppConnectionName, Namespace: namespace},
+			Spec: awiv1alpha1.AppConnectionSpec{
+				AppConnection: awi.AppConnection{
+					Metadata: &awi.AppMetadata{Name: retainedAppConnectionName},
+					NetworkDomainConnection: &awi.NetworkDomainConnection{
+						Selector: &awi.NetworkDomainConnection_Selector{MatchName: clusterConnectionId},
+					},
+				},
+				DeletionPolicy: awiv1alpha1.DeletionPolicyRetain,
+			},
+		}
+		Expect(k8sClient.Create(ctx, appConn)).Should(Succeed())
+
+		lookupKey := types.NamespacedName{Name: retainedAppConnectionName, Namespace: namespace}
+		Eventually(func() string {
+			connObj := &awiv1alpha1.InterNetworkDomainAppConnection{}
+			if err := k8sClient.Get(ctx, lookupKey, connObj); err != nil {
+				return ""
+			}
+			return connObj.Status.ConnectionId
+		}, 10*time.Second, 250*time.Millisecond).Should(Equal(appConnectionID))
+
+		Expect(k8sClient.Delete(ctx, appConn)).Should(Succeed())
+		Eventually(func() bool {
+			err := k8sClient.Get(ctx, lookupKey, &awiv1alpha1.InterNetworkDomainAppConnection{})
+			return apierrors.IsNotFound(err)
+		}, 10*time.Second, 250*time.Millisecond).Should(BeTrue())
+	})
+
+	It("should mark app connection as failed when referenced access policy doesn't exist", func() {
+		const failedAppConnectionName = "appconnection-missing-policy"
+
+		t := GinkgoT()
+		// no expectations - connection request must not be sent
+		mockConnectionController := awiMock.NewAppConnectionControllerClient(t)
+		defer mockConnectionController.AssertExpectations(t)
+		awiTestClient.AppConnectionControllerClient = mockConnectionController
+
+		appConn := &awiv1alpha1.InterNetworkDomainAppConnection{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "awi.app-net-interface.io/v1alpha1", Kind: "InterNetworkDomainAppConnection"},
+			ObjectMeta: metav1.ObjectMeta{Name: failedAppConnectionName, Namespace: namespace},
+			Spec: awiv1alpha1.AppConnectionSpec{
+				AppConnection: awi.AppConnection{
+					Metadata: &awi.AppMetadata{
+						Name: failedAppConnectionName,
+					},
+					NetworkDomainConnection: &awi.NetworkDomainConnection{
+						Selector: &awi.NetworkDomainConnection_Selector{MatchName: clusterConnectionId},
+					},
+					AccessPolicy: &awi.AccessPolicySelector{
+						Selector: &awi.AccessPolicySelector_Selector{
+							MatchName: &awi.AccessPolicySelector_MatchName{Name: "non-existing-policy"},
+						},
+					},
+				},
+			},
+		}
+		Expect(k8sClient.Create(ctx, appConn)).Should(Succeed())
+
+		lookupKey := types.NamespacedName{Name: failedAppConnectionName, Namespace: namespace}
+		Eventually(func() string {
+			connObj := &awiv1alpha1.InterNetworkDomainAppConnection{}
+			if err := k8sClient.Get(ctx, lookupKey, connObj); err != nil {
+				return ""
+			}
+			return connObj.Status.State
+		}, 10*time.Second, 250*time.Millisecond).Should(Equal("FAILED"))
+	})
+
+	It("should resolve gateway addresses and listener ports into the service endpoint", func() {
+		ipAddress := gatewayv1.IPAddressType
+		hostname := gatewayv1.HostnameAddressType
+		gateway := &gatewayv1.Gateway{
+			Spec: gatewayv1.GatewaySpec{
+				Listeners: []gatewayv1.Listener{
+					{Name: "https", Port: 443, Protocol: gatewayv1.HTTPSProtocolType},
+					{Name: "http", Port: 80, Protocol: gatewayv1.HTTPProtocolType},
+					{Name: "http-alt", Port: 80, Protocol: gatewayv1.HTTPProtocolType},
+				},
+			},
+			Status: gatewayv1.GatewayStatus{
+				Addresses: []gatewayv1.GatewayStatusAddress{
+					{Type: &ipAddress, Value: "10.0.0.2"},
+					{Type: &ipAddress, Value: "10.0.0.1"},
+					{Type: &hostname, Value: "0.gateway.example.com"},
+				},
+			},
+		}
+		endpoint := gatewayEndpointOf(gateway)
+		Expect(endpoint.Addresses).To(Equal([]string{"0.gateway.example.com", "10.0.0.1", "10.0.0.2"}))
+		Expect(endpoint.Ports).To(Equal([]int32{80, 443}))
+
+		appConnection := &awi.AppConnection{
+			Metadata: &awi.AppMetadata{Name: "to-gateway"},
+			To: &awi.To{
+				Service: &awi.Service{
+					Kind: &awi.ServiceKind{K8SService: &awi.ServiceKind_K8SService{ServiceType: GatewayServiceType}},
+					Selector: &awi.Service_Selector{
+						MatchName: &awi.MatchName{Name: "web"},
+					},
+				},
+			},
+		}
+		Expect(isGatewayService(appConnection)).To(BeTrue())
+		resolved := gatewayAppConnection(appConnection, endpoint)
+		// IP address is preferred over hostname which sorts first
+		Expect(resolved.GetTo().GetService().GetSelector().GetMatchHost().GetIp()).To(Equal("10.0.0.1"))
+		Expect(resolved.GetMetadata().GetLabel()).To(Equal(map[string]string{
+			"gateway-addresses": "0.gateway.example.com,10.0.0.1,10.0.0.2",
+			"gateway-ports":     "80,443",
+		}))
+		// the spec stored in CRD must not be modified
+		Expect(appConnection.GetTo().GetService().GetSelector().GetMatchHost()).To(BeNil())
+	})
+
+	It("should resolve pod endpoints of the app connection and expose them in status", func() {
+		const podsAppConnectionName = "appconnection-pod-endpoints"
+
+		t := GinkgoT()
+		mockConnectionController := awiMock.NewAppConnectionControllerClient(t)
+		mockConnectionController.EXPECT().ConnectApps(mock.Anything, mock.Anything).
+			Return(&awi.AppConnectionResponse{}, nil).Maybe()
+		mockConnectionController.EXPECT().ListConnectedApps(mock.Anything, mock.Anything).
+			Return(&awi.ListAppConnectionsResponse{}, nil).Maybe()
+		awiTestClient.AppConnectionControllerClient = mockConnectionController
+
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "training-0",
+				Namespace: namespace,
+				Labels:    map[string]string{"app": "training"},
+			},
+			Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "training", Image: "training"}}},
+		}
+		Expect(k8sClient.Create(ctx, pod)).Should(Succeed())
+		pod.Status = corev1.PodStatus{
+			Phase:  corev1.PodRunning,
+			PodIP:  "10.1.0.7",
+			PodIPs: []corev1.PodIP{{IP: "10.1.0.7"}},
+		}
+		Expect(k8sClient.Status().Update(ctx, pod)).Should(Succeed())
+
+		appConn := &awiv1alpha1.InterNetworkDomainAppConnection{
+			ObjectMeta: metav1.ObjectMeta{Name: podsAppConnectionName, Namespace: namespace},
+			Spec: awiv1alpha1.AppConnectionSpec{
+				AppConnection: awi.AppConnection{
+					Metadata: &awi.AppMetadata{Name: podsAppConnectionName},
+					NetworkDomainConnection: &awi.NetworkDomainConnection{
+						Selector: &awi.NetworkDomainConnection_Selector{MatchName: clusterConnectionId},
+					},
+					From: &awi.From{
+						Endpoint: &awi.Endpoint{
+							Kind:     "pod",
+							Selector: &awi.Endpoint_Selector{MatchLabels: map[string]string{"app": "training"}},
+						},
+					},
+				},
+			},
+		}
+		Expect(k8sClient.Create(ctx, appConn)).Should(Succeed())
+
+		lookupKey := types.NamespacedName{Name: podsAppConnectionName, Namespace: namespace}
+		Eventually(func() []string {
+			connObj := &awiv1alpha1.InterNetworkDomainAppConnection{}
+			if err := k8sClient.Get(ctx, lookupKey, connObj); err != nil {
+				return nil
+			}
+			return connObj.Status.ResolvedEndpoints
+		}, 10*time.Second, 250*time.Millisecond).Should(Equal([]string{"10.1.0.7"}))
+	})
+
+	It("should pass resolved pod IPs to AWI as source prefixes", func() {
+		appConnection := &awi.AppConnection{
+			From: &awi.From{
+				Endpoint: &awi.Endpoint{
+					Kind:     "pod",
+					Selector: &awi.Endpoint_Selector{MatchLabels: map[string]string{"app": "training"}},
+				},
+			},
+		}
+		resolved := podEndpointsAppConnection(appConnection, []string{"10.1.0.7", "fd00::7"})
+		Expect(resolved.GetFrom().GetEndpoint()).To(BeNil())
+		Expect(resolved.GetFrom().GetSubnet().GetSelector().GetMatchPrefix()).
+			To(Equal([]string{"10.1.0.7/32", "fd00::7/128"}))
+		// the spec stored in CRD must not be modified
+		Expect(appConnection.GetFrom().GetEndpoint().GetKind()).To(Equal("pod"))
+		Expect(appConnection.GetFrom().GetSubnet()).To(BeNil())
+	})
+
+	It("should leave adopted app connection selecting pods as it is", func() {
+		const (
+			adoptedAppConnectionName = "appconnection-adopted-pods"
+			adoptedAppConnectionID   = "adopted-app-connection-id"
+		)
+
+		t := GinkgoT()
+		// no expectations - neither connect nor disconnect can be sent
+		mockConnectionController := awiMock.NewAppConnectionControllerClient(t)
+		defer mockConnectionController.AssertExpectations(t)
+		awiTestClient.AppConnectionControllerClient = mockConnectionController
+
+		appConn := &awiv1alpha1.InterNetworkDomainAppConnection{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      adoptedAppConnectionName,
+				Namespace: namespace,
+				Annotations: map[string]string{
+					awiv1alpha1.AdoptedConnectionIdAnnotation: adoptedAppConnectionID,
+					awiv1alpha1.DeletionPolicyAnnotation:      awiv1alpha1.DeletionPolicyRetain,
+				},
+			},
+			Spec: awiv1alpha1.AppConnectionSpec{
+				AppConnection: awi.AppConnection{
+					Metadata: &awi.AppMetadata{Name: adoptedAppConnectionName},
+					From: &awi.From{
+						Endpoint: &awi.Endpoint{
+							Kind:     "pod",
+							Selector: &awi.Endpoint_Selector{MatchLabels: map[string]string{"app": "adopted"}},
+						},
+					},
+				},
+			},
+		}
+		Expect(k8sClient.Create(ctx, appConn)).Should(Succeed())
+
+		lookupKey := types.NamespacedName{Name: adoptedAppConnectionName, Namespace: namespace}
+		Eventually(func() string {
+			connObj := &awiv1alpha1.InterNetworkDomainAppConnection{}
+			if err := k8sClient.Get(ctx, lookupKey, connObj); err != nil {
+				return ""
+			}
+			return connObj.Status.ConnectionId
+		}, 10*time.Second, 250*time.Millisecond).Should(Equal(adoptedAppConnectionID))
+
+		By("starting a selected pod")
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "adopted-0",
+				Namespace: namespace,
+				Labels:    map[string]string{"app": "adopted"},
+			},
+			Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "adopted", Image: "adopted"}}},
+		}
+		Expect(k8sClient.Create(ctx, pod)).Should(Succeed())
+		pod.Status = corev1.PodStatus{
+			Phase:  corev1.PodRunning,
+			PodIP:  "10.1.2.7",
+			PodIPs: []corev1.PodIP{{IP: "10.1.2.7"}},
+		}
+		Expect(k8sClient.Status().Update(ctx, pod)).Should(Succeed())
+
+		Consistently(func() []string {
+			connObj := &awiv1alpha1.InterNetworkDomainAppConnection{}
+			if err := k8sClient.Get(ctx, lookupKey, connObj); err != nil {
+				return nil
+			}
+			return connObj.Status.ResolvedEndpoints
+		}, 2*time.Second, 250*time.Millisecond).Should(BeEmpty())
+
+		Expect(k8sClient.Delete(ctx, appConn)).Should(Succeed())
+		Eventually(func() bool {
+			err := k8sClient.Get(ctx, lookupKey, &awiv1alpha1.InterNetworkDomainAppConnection{})
+			return apierrors.IsNotFound(err)
+		}, 10*time.Second, 250*time.Millisecond).Should(BeTrue())
+	})
+
+	It("should request app connection with new pod endpoints before removing the previous one", func() {
+		const replacedAppConnectionName = "appconnection-replaced-endpoints"
+
+		var (
+			callsLock sync.Mutex
+			calls     []string
+		)
+		record := func(call string) {
+			callsLock.Lock()
+			defer callsLock.Unlock()
+			calls = append(calls, call)
+		}
+		t := GinkgoT()
+		mockConnectionController := awiMock.NewAppConnectionControllerClient(t)
+		mockConnectionController.EXPECT().ConnectApps(mock.Anything, mock.Anything).
+			Run(func(_ context.Context, _ *awi.AppConnection, _ ...grpc.CallOption) {
+				record("connect")
+			}).
+			Return(&awi.AppConnectionResponse{AppConnId: "pods-previous"}, nil).Once()
+		mockConnectionController.EXPECT().ConnectApps(mock.Anything, mock.Anything).
+			Run(func(_ context.Context, _ *awi.AppConnection, _ ...grpc.CallOption) {
+				record("connect")
+			}).
+			Return(&awi.AppConnectionResponse{AppConnId: "pods-current"}, nil).Maybe()
+		mockConnectionController.EXPECT().DisconnectApps(mock.Anything, mock.Anything).
+			Run(func(_ context.Context, req *awi.AppDisconnectionRequest, _ ...grpc.CallOption) {
+				record("disconnect " + req.GetConnectionId())
+			}).
+			Return(&awi.AppDisconnectionResponse{}, nil).Maybe()
+		awiTestClient.AppConnectionControllerClient = mockConnectionController
+
+		pod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "replaced-0",
+				Namespace: namespace,
+				Labels:    map[string]string{"app": "replaced"},
+			},
+			Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "replaced", Image: "replaced"}}},
+		}
+		Expect(k8sClient.Create(ctx, pod)).Should(Succeed())
+		pod.Status = corev1.PodStatus{
+			Phase:  corev1.PodRunning,
+			PodIP:  "10.1.1.7",
+			PodIPs: []corev1.PodIP{{IP: "10.1.1.7"}},
+		}
+		Expect(k8sClient.Status().Update(ctx, pod)).Should(Succeed())
+
+		appConn := &awiv1alpha1.InterNetworkDomainAppConnection{
+			ObjectMeta: metav1.ObjectMeta{Name: replacedAppConnectionName, Namespace: namespace},
+			Spec: awiv1alpha1.AppConnectionSpec{
+				AppConnection: awi.AppConnection{
+					Metadata: &awi.AppMetadata{Name: replacedAppConnectionName},
+					NetworkDomainConnection: &awi.NetworkDomainConnection{
+						Selector: &awi.NetworkDomainConnection_Selector{MatchName: clusterConnectionId},
+					},
+					From: &awi.From{
+						Endpoint: &awi.Endpoint{
+							Kind:     "pod",
+							Selector: &awi.Endpoint_Selector{MatchLabels: map[string]string{"app": "replaced"}},
+						},
+					},
+				},
+			},
+		}
+		Expect(k8sClient.Create(ctx, appConn)).Should(Succeed())
+
+		lookupKey := types.NamespacedName{Name: replacedAppConnectionName, Namespace: namespace}
+		Eventually(func() string {
+			connObj := &awiv1alpha1.InterNetworkDomainAppConnection{}
+			if err := k8sClient.Get(ctx, lookupKey, connObj); err != nil {
+				return ""
+			}
+			return connObj.Status.ConnectionId
+		}, 10*time.Second, 250*time.Millisecond).Should(Equal("pods-previous"))
+
+		By("changing IP of the pod")
+		pod.Status.PodIP = "10.1.1.8"
+		pod.Status.PodIPs = []corev1.PodIP{{IP: "10.1.1.8"}}
+		Expect(k8sClient.Status().Update(ctx, pod)).Should(Succeed())
+
+		Eventually(func() bool {
+			connObj := &awiv1alpha1.InterNetworkDomainAppConnection{}
+			if err := k8sClient.Get(ctx, lookupKey, connObj); err != nil {
+				return false
+			}
+			return connObj.Status.ConnectionId == "pods-current" && connObj.Status.ReplacedConnectionId == ""
+		}, 10*time.Second, 250*time.Millisecond).Should(BeTrue())
+		callsLock.Lock()
+		defer callsLock.Unlock()
+		Expect(calls).To(Equal([]string{"connect", "connect", "disconnect pods-previous"}))
+	})
+
+	It("should read status stored as a plain string", func() {
+		var status awiv1alpha1.InterNetworkDomainAppConnectionStatus
+		Expect(json.Unmarshal([]byte(`"SUCCESS"`), &status)).To(Succeed())
+		Expect(status.State).To(Equal("SUCCESS"))
+		Expect(json.Unmarshal([]byte(`{"state":"FAILED","resolved_endpoints":["10.1.0.7"]}`), &status)).To(Succeed())
+		Expect(status.State).To(Equal("FAILED"))
+		Expect(status.ResolvedEndpoints).To(Equal([]string{"10.1.0.7"}))
+	})
 })
@@ -18,8 +18,11 @@ package controllers
 
 import (
 	"context"
+	"time"
 
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
@@ -29,18 +32,27 @@ import (
 
 	awiv1alpha1 "app-net-interface.io/kube-awi/api/awi/v1alpha1"
 	awiClient "app-net-interface.io/kube-awi/client"
+	"app-net-interface.io/kube-awi/pkg/connection_status"
+	"app-net-interface.io/kube-awi/pkg/tracing"
+	awipb "github.com/app-net-interface/awi-grpc/pb"
 )
 
 // InterNetworkDomainConnectionReconciler reconciles a InterNetworkDomainConnection object
 type InterNetworkDomainConnectionReconciler struct {
 	client.Client
-	Scheme    *runtime.Scheme
-	AwiClient *awiClient.AwiGrpcClient
+	Scheme      *runtime.Scheme
+	AwiClient   *awiClient.AwiGrpcClient
+	ClusterName string
+	Recorder    record.EventRecorder
+	// DriftCheckInterval is how often the connection is checked in AWI and
+	// re-issued if it went missing or failed, zero disables the checks
+	DriftCheckInterval time.Duration
 }
 
 //+kubebuilder:rbac:groups=awi.app-net-interface.io,resources=internetworkdomainconnections,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=awi.app-net-interface.io,resources=internetworkdomainconnections/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=awi.app-net-interface.io,resources=internetworkdomainconnections/finalizers,verbs=update
+//+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
 
 func (r *InterNetworkDomainConnectionReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	logger := log.FromContext(ctx)
@@ -60,6 +72,21 @@ func (r *InterNetworkDomainConnectionReconciler) Reconcile(ctx context.Context,
 	// name of our custom finalizer
 	myFinalizerName := "internetworkdomainconnection.awi.app-net-interface.io/finalizer"
 
+	if setSuspendedCondition(&conn.Status.Conditions, conn.IsSuspended(), conn.GetGeneration()) {
+		if err := r.Status().Update(ctx, &conn); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	if conn.IsSuspended() {
+		// no AWI calls are made while suspended, deletion waits until resumed
+		logger.Info("Reconciliation of InterNetworkDomainConnection is suspended", "namespace", req.Namespace, "name", req.Name)
+		return ctrl.Result{}, nil
+	}
+
+	// objects which already had the finalizer could have been connected
+	// without storing the ID, by an older version or by a lost response
+	findExisting := controllerutil.ContainsFinalizer(&conn, myFinalizerName) && conn.Status.ConnectionId == ""
+
 	// examine DeletionTimestamp to determine if object is under deletion
 	if conn.ObjectMeta.DeletionTimestamp.IsZero() {
 		// The object is not being deleted, so if it does not have our finalizer,
@@ -76,11 +103,20 @@ func (r *InterNetworkDomainConnectionReconciler) Reconcile(ctx context.Context,
 		logger.Info("InterNetworkDomainConnection is being deleted", "namespace", req.Namespace, "name", req.Name)
 		if controllerutil.ContainsFinalizer(&conn, myFinalizerName) {
 			// our finalizer is present, so lets handle any external dependency
-			if err := r.removeConnection(&conn); err != nil {
+			if retainsConnection(&conn, conn.Spec.DeletionPolicy) {
+				logger.Info("Retaining connection in AWI", "id", conn.Status.ConnectionId)
+				err := connection_status.RecordRetainedConnection(ctx, r.Client, &conn, conn.Status.ConnectionId)
+				if err != nil {
+					logger.Error(err, "Failed to record retained connection")
+					return ctrl.Result{}, err
+				}
+				r.Recorder.Eventf(&conn, corev1.EventTypeNormal, "Retained",
+					"Connection %s was left in AWI", conn.Status.ConnectionId)
+			} else if err := r.removeConnection(ctx, &conn); err != nil {
 				// if fail to disconnect here, return with error
 				// so that it can be retried
 				logger.Error(err, "Failed to send disconnect request to awi server")
-				return ctrl.Result{}, err
+				return deletionErrorResult(ctx, r.Client, &conn, &conn.Status.Conditions, err)
 			}
 
 			// remove our finalizer from the list and update it.
@@ -94,11 +130,75 @@ func (r *InterNetworkDomainConnectionReconciler) Reconcile(ctx context.Context,
 		return ctrl.Result{}, nil
 	}
 
-	err := r.AwiClient.ConnectionRequest(&conn.Spec)
+	if adoptedId := adoptedConnectionId(&conn); adoptedId != "" && conn.Status.ConnectionId == "" {
+		logger.Info("Adopting existing connection", "id", adoptedId)
+		conn.Status.ConnectionId = adoptedId
+		return ctrl.Result{}, r.Status().Update(ctx, &conn)
+	}
+	if findExisting {
+		// the status watcher migrates such objects as well, but it runs
+		// only after the reconcilers started
+		existingId, err := existingConnectionId(ctx, r.AwiClient, &conn)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if existingId != "" {
+			logger.Info("Found connection created without stored ID", "id", existingId)
+			conn.Status.ConnectionId = existingId
+			if err := r.Status().Update(ctx, &conn); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+	}
+	if conn.Status.ConnectionId != "" {
+		// connection was already created in AWI and it can't be updated,
+		// it's only re-issued if it went missing or failed
+		if r.DriftCheckInterval == 0 || adoptedConnectionId(&conn) != "" {
+			return ctrl.Result{}, nil
+		}
+		// state in AWI is tracked by the status watcher
+		if !drifted(conn.Status.State, conn.Status.Conditions) {
+			if resetReconnects(&conn.Status.DriftStatus, conn.Status.State) {
+				if err := r.Status().Update(ctx, &conn); err != nil {
+					return ctrl.Result{}, err
+				}
+			}
+			return ctrl.Result{RequeueAfter: r.DriftCheckInterval}, nil
+		}
+		if wait := reconnectWait(&conn.Status.DriftStatus); wait > 0 {
+			return ctrl.Result{RequeueAfter: wait}, nil
+		}
+		logger.Info("Re-issuing connection missing or failed in AWI", "id", conn.Status.ConnectionId,
+			"state", conn.Status.State, "attempts", conn.Status.ReconnectAttempts)
+		if conn.Status.State != awiv1alpha1.StateMissing {
+			if err := r.removeConnection(ctx, &conn); err != nil {
+				logger.Error(err, "Failed to send disconnect request to awi server")
+				return awiErrorResult(ctx, r.Client, &conn, &conn.Status.Conditions, &conn.Status.State, err)
+			}
+		}
+		recordReconnect(&conn.Status.DriftStatus)
+		conn.Status.ConnectionId = ""
+		conn.Status.State = awipb.Status_name[int32(awipb.Status_IN_PROGRESS)]
+		if err := r.Status().Update(ctx, &conn); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	connectionId, err := r.AwiClient.ConnectionRequest(ctx, connectionWithIdentity(&conn, r.ClusterName))
 	if err != nil {
 		logger.Error(err, "Failed to send connection request to awi server")
+		return awiErrorResult(ctx, r.Client, &conn, &conn.Status.Conditions, &conn.Status.State, err)
+	}
+	if connectionId == "" {
+		return ctrl.Result{}, nil
+	}
+	conn.Status.ConnectionId = connectionId
+	if clearTerminalError(&conn.Status.Conditions) {
+		conn.Status.State = awipb.Status_name[int32(awipb.Status_IN_PROGRESS)]
+	}
+	if err := r.Status().Update(ctx, &conn); err != nil {
+		return ctrl.Result{}, err
 	}
-	return ctrl.Result{}, err
+	return ctrl.Result{RequeueAfter: r.DriftCheckInterval}, nil
 }
 
 // SetupWithManager sets up the controller with the Manager.
@@ -109,18 +209,20 @@ func (r *InterNetworkDomainConnectionReconciler) SetupWithManager(mgr ctrl.Manag
 			UpdateFunc: func(e event.UpdateEvent) bool {
 				// update of network domains connection is not supported, so we ignore all update events
 				// except for cases when deletion timestamp is not zero, this means object is being deleted, and
-				// we want to call finalizer
-				return !e.ObjectNew.GetDeletionTimestamp().IsZero()
+				// we want to call finalizer, reconciliation is suspended or resumed, or spec
+				// rejected by AWI was changed
+				return !e.ObjectNew.GetDeletionTimestamp().IsZero() || suspendToggled(e) ||
+					changedAfterTerminalError(e)
 			},
 			DeleteFunc: func(deleteEvent event.DeleteEvent) bool {
 				// ignore delete events as delete logic is being handled by finalizer
 				return false
 			},
 		}).
-		Complete(r)
+		Complete(tracing.Reconciler("InterNetworkDomainConnection", r))
 }
 
-func (r *InterNetworkDomainConnectionReconciler) removeConnection(conn *awiv1alpha1.InterNetworkDomainConnection) error {
+func (r *InterNetworkDomainConnectionReconciler) removeConnection(ctx context.Context, conn *awiv1alpha1.InterNetworkDomainConnection) error {
 	// sending disconnect request
-	return r.AwiClient.DisconnectRequest(&conn.Spec)
+	return r.AwiClient.DisconnectRequest(ctx, connectionWithIdentity(conn, r.ClusterName), conn.Status.ConnectionId)
 }
@@ -41,9 +41,16 @@ import (
 	. "github.com/onsi/gomega"
 	"github.com/stretchr/testify/mock"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 
 	awiv1alpha1 "app-net-interface.io/kube-awi/api/awi/v1alpha1"
+	awiCl "app-net-interface.io/kube-awi/client"
 	awiMock "github.com/app-net-interface/awi-grpc/mocks"
 	awi "github.com/app-net-interface/awi-grpc/pb"
 )
@@ -53,6 +60,7 @@ var _ = Describe("InternNetworkDomain Controller", func() {
 		//Meta
 		internetworkdomainconnectionName = "sample-connection-svc"
 		namespace                        = "default"
+		connectionID                     = "connection-id-1"
 	)
 
 	It("send should send connection request to grpc server whenever new CRD is created", func() {
@@ -94,16 +102,18 @@ var _ = Describe("InternNetworkDomain Controller", func() {
 		// to happen
 		creaCtx, creCancel := context.WithCancel(context.Background())
 		mockConnectionController.EXPECT().
-			Connect(mock.Anything, connectionRequestSpec).
-			Run(func(_ context.Context, _ *awi.ConnectionRequest, _ ...grpc.CallOption) {
+			Connect(mock.Anything, mock.Anything).
+			Run(func(_ context.Context, req *awi.ConnectionRequest, _ ...grpc.CallOption) {
+				Expect(proto.Equal(req.GetSpec(), connectionRequestSpec.GetSpec())).To(BeTrue())
+				Expect(req.GetMetadata().GetLabels()).To(HaveKeyWithValue(awiCl.OwnerNamespaceLabel, namespace))
 				creCancel()
 			}).
-			Return(&awi.ConnectionResponse{}, nil)
+			Return(&awi.ConnectionResponse{ConnectionId: connectionID}, nil)
 
 		connSvc := &awiv1alpha1.InterNetworkDomainConnection{
 			TypeMeta:   metav1.TypeMeta{APIVersion: "awi.app-net-interface.io/v1alpha1", Kind: "InterNetworkDomainConnection"},
 			ObjectMeta: metav1.ObjectMeta{Name: internetworkdomainconnectionName, Namespace: namespace},
-			Spec:       *connectionRequestSpec,
+			Spec:       awiv1alpha1.InterNetworkDomainConnectionSpec{ConnectionRequest: *connectionRequestSpec},
 		}
 		Expect(k8sClient.Create(ctx, connSvc)).Should(Succeed())
 		select {
@@ -112,11 +122,22 @@ var _ = Describe("InternNetworkDomain Controller", func() {
 			t.Errorf("Deadline for create call to mock connection controller exceeded")
 		}
 
+		By("connection ID returned by awi server should be stored in status")
+		lookupKey := types.NamespacedName{Name: internetworkdomainconnectionName, Namespace: namespace}
+		Eventually(func() string {
+			connObj := &awiv1alpha1.InterNetworkDomainConnection{}
+			if err := k8sClient.Get(ctx, lookupKey, connObj); err != nil {
+				return ""
+			}
+			return connObj.Status.ConnectionId
+		}, 10*time.Second, 250*time.Millisecond).Should(Equal(connectionID))
+
 		By("removing object")
 		delCtx, delCanc := context.WithCancel(context.Background())
 		mockConnectionController.EXPECT().
 			Disconnect(mock.Anything, mock.Anything).
-			Run(func(_ context.Context, _ *awi.DisconnectRequest, _ ...grpc.CallOption) {
+			Run(func(_ context.Context, req *awi.DisconnectRequest, _ ...grpc.CallOption) {
+				Expect(req.GetConnectionId()).To(Equal(connectionID))
 				delCanc()
 			}).
 			Return(&awi.DisconnectResponse{}, nil)
@@ -128,4 +149,284 @@ var _ = Describe("InternNetworkDomain Controller", func() {
 			t.Errorf("Deadline for delete call to mock connection controller exceeded")
 		}
 	})
+
+	It("should adopt existing connection and retain it on deletion", func() {
+		const (
+			adoptedConnectionName = "adopted-connection"
+			adoptedConnectionID   = "adopted-connection-id"
+		)
+
+		t := GinkgoT()
+		// no expectations - neither connect nor disconnect can be sent
+		mockConnectionController := awiMock.NewConnectionControllerClient(t)
+		defer mockConnectionController.AssertExpectations(t)
+		awiTestClient.ConnectionControllerClient = mockConnectionController
+
+		connSvc := &awiv1alpha1.InterNetworkDomainConnection{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      adoptedConnectionName,
+				Namespace: namespace,
+				Annotations: map[string]string{
+					awiv1alpha1.AdoptedConnectionIdAnnotation: adoptedConnectionID,
+					awiv1alpha1.DeletionPolicyAnnotation:      awiv1alpha1.DeletionPolicyRetain,
+				},
+			},
+			Spec: awiv1alpha1.InterNetworkDomainConnectionSpec{
+				ConnectionRequest: awi.ConnectionRequest{
+					Metadata: &awi.ConnectionMetadata{Name: adoptedConnectionName},
+				},
+			},
+		}
+		Expect(k8sClient.Create(ctx, connSvc)).Should(Succeed())
+
+		lookupKey := types.NamespacedName{Name: adoptedConnectionName, Namespace: namespace}
+		Eventually(func() string {
+			connObj := &awiv1alpha1.InterNetworkDomainConnection{}
+			if err := k8sClient.Get(ctx, lookupKey, connObj); err != nil {
+				return ""
+			}
+			return connObj.Status.ConnectionId
+		}, 10*time.Second, 250*time.Millisecond).Should(Equal(adoptedConnectionID))
+
+		Expect(k8sClient.Delete(ctx, connSvc)).Should(Succeed())
+		Eventually(func() bool {
+			err := k8sClient.Get(ctx, lookupKey, &awiv1alpha1.InterNetworkDomainConnection{})
+			return apierrors.IsNotFound(err)
+		}, 10*time.Second, 250*time.Millisecond).Should(BeTrue())
+	})
+
+	It("should not connect suspended connection until it's resumed", func() {
+		const (
+			suspendedConnectionName = "suspended-connection"
+			suspendedConnectionID   = "suspended-connection-id"
+		)
+
+		t := GinkgoT()
+		// no expectations - connect can't be sent while suspended
+		mockConnectionController := awiMock.NewConnectionControllerClient(t)
+		defer mockConnectionController.AssertExpectations(t)
+		awiTestClient.ConnectionControllerClient = mockConnectionController
+
+		connSvc := &awiv1alpha1.InterNetworkDomainConnection{
+			ObjectMeta: metav1.ObjectMeta{Name: suspendedConnectionName, Namespace: namespace},
+			Spec: awiv1alpha1.InterNetworkDomainConnectionSpec{
+				ConnectionRequest: awi.ConnectionRequest{
+					Metadata: &awi.ConnectionMetadata{Name: suspendedConnectionName},
+				},
+				Suspend: true,
+			},
+		}
+		Expect(k8sClient.Create(ctx, connSvc)).Should(Succeed())
+
+		lookupKey := types.NamespacedName{Name: suspendedConnectionName, Namespace: namespace}
+		Eventually(func() bool {
+			connObj := &awiv1alpha1.InterNetworkDomainConnection{}
+			if err := k8sClient.Get(ctx, lookupKey, connObj); err != nil {
+				return false
+			}
+			return meta.IsStatusConditionTrue(connObj.Status.Conditions, awiv1alpha1.ConditionSuspended)
+		}, 10*time.Second, 250*time.Millisecond).Should(BeTrue())
+
+		By("resuming the connection")
+		mockConnectionController.EXPECT().
+			Connect(mock.Anything, mock.Anything).
+			Return(&awi.ConnectionResponse{ConnectionId: suspendedConnectionID}, nil)
+		connObj := &awiv1alpha1.InterNetworkDomainConnection{}
+		Expect(k8sClient.Get(ctx, lookupKey, connObj)).Should(Succeed())
+		connObj.Spec.Suspend = false
+		Expect(k8sClient.Update(ctx, connObj)).Should(Succeed())
+
+		Eventually(func() bool {
+			connObj := &awiv1alpha1.InterNetworkDomainConnection{}
+			if err := k8sClient.Get(ctx, lookupKey, connObj); err != nil {
+				return false
+			}
+			return connObj.Status.ConnectionId == suspendedConnectionID &&
+				meta.IsStatusConditionFalse(connObj.Status.Conditions, awiv1alpha1.ConditionSuspended)
+		}, 10*time.Second, 250*time.Millisecond).Should(BeTrue())
+	})
+
+	It("should back off re-issuing connections which keep drifting", func() {
+		Expect(drifted(awiv1alpha1.StateMissing, nil)).To(BeTrue())
+		Expect(drifted(awi.Status_FAILED.String(), nil)).To(BeTrue())
+		Expect(drifted(awi.Status_IN_PROGRESS.String(), nil)).To(BeFalse())
+		// request rejected by AWI isn't re-issued until the spec is changed
+		Expect(drifted(awi.Status_FAILED.String(), []metav1.Condition{{
+			Type:   awiv1alpha1.ConditionTerminalError,
+			Status: metav1.ConditionTrue,
+		}})).To(BeFalse())
+
+		status := &awiv1alpha1.DriftStatus{}
+		Expect(reconnectWait(status)).To(BeNumerically("<=", 0))
+		recordReconnect(status)
+		Expect(status.ReconnectAttempts).To(Equal(int32(1)))
+		Expect(reconnectWait(status)).To(BeNumerically("~", reconnectBackoffBase, time.Second))
+		recordReconnect(status)
+		Expect(reconnectWait(status)).To(BeNumerically("~", 2*reconnectBackoffBase, time.Second))
+		Expect(reconnectBackoff(100)).To(Equal(reconnectBackoffMax))
+
+		Expect(resetReconnects(status, awi.Status_FAILED.String())).To(BeFalse())
+		Expect(resetReconnects(status, awi.Status_SUCCESS.String())).To(BeTrue())
+		Expect(status.ReconnectAttempts).To(BeZero())
+	})
+
+	It("should stop retrying connection rejected by AWI", func() {
+		const rejectedConnectionName = "rejected-connection"
+
+		t := GinkgoT()
+		mockConnectionController := awiMock.NewConnectionControllerClient(t)
+		defer mockConnectionController.AssertExpectations(t)
+		awiTestClient.ConnectionControllerClient = mockConnectionController
+		// terminal error isn't requeued, so connect is sent once
+		mockConnectionController.EXPECT().
+			Connect(mock.Anything, mock.Anything).
+			Return(nil, status.Error(codes.InvalidArgument, "unknown network domain")).
+			Once()
+
+		connSvc := &awiv1alpha1.InterNetworkDomainConnection{
+			ObjectMeta: metav1.ObjectMeta{Name: rejectedConnectionName, Namespace: namespace},
+			Spec: awiv1alpha1.InterNetworkDomainConnectionSpec{
+				ConnectionRequest: awi.ConnectionRequest{
+					Metadata: &awi.ConnectionMetadata{Name: rejectedConnectionName},
+				},
+			},
+		}
+		Expect(k8sClient.Create(ctx, connSvc)).Should(Succeed())
+
+		lookupKey := types.NamespacedName{Name: rejectedConnectionName, Namespace: namespace}
+		Eventually(func() bool {
+			connObj := &awiv1alpha1.InterNetworkDomainConnection{}
+			if err := k8sClient.Get(ctx, lookupKey, connObj); err != nil {
+				return false
+			}
+			condition := meta.FindStatusCondition(connObj.Status.Conditions, awiv1alpha1.ConditionTerminalError)
+			return condition != nil && condition.Status == metav1.ConditionTrue &&
+				condition.Reason == codes.InvalidArgument.String() && connObj.Status.State == "FAILED"
+		}, 10*time.Second, 250*time.Millisecond).Should(BeTrue())
+		Consistently(func() int {
+			return len(mockConnectionController.Calls)
+		}, 2*time.Second, 250*time.Millisecond).Should(Equal(1))
+	})
+
+	It("should keep retrying removal of deleted connection rejected by AWI", func() {
+		const (
+			undeletableConnectionName = "undeletable-connection"
+			undeletableConnectionID   = "undeletable-connection-id"
+		)
+
+		t := GinkgoT()
+		mockConnectionController := awiMock.NewConnectionControllerClient(t)
+		awiTestClient.ConnectionControllerClient = mockConnectionController
+		mockConnectionController.EXPECT().
+			Connect(mock.Anything, mock.Anything).
+			Return(&awi.ConnectionResponse{ConnectionId: undeletableConnectionID}, nil)
+		mockConnectionController.EXPECT().
+			Disconnect(mock.Anything, mock.Anything).
+			Return(nil, status.Error(codes.InvalidArgument, "connection in use"))
+
+		connSvc := &awiv1alpha1.InterNetworkDomainConnection{
+			ObjectMeta: metav1.ObjectMeta{Name: undeletableConnectionName, Namespace: namespace},
+			Spec: awiv1alpha1.InterNetworkDomainConnectionSpec{
+				ConnectionRequest: awi.ConnectionRequest{
+					Metadata: &awi.ConnectionMetadata{Name: undeletableConnectionName},
+				},
+			},
+		}
+		Expect(k8sClient.Create(ctx, connSvc)).Should(Succeed())
+
+		lookupKey := types.NamespacedName{Name: undeletableConnectionName, Namespace: namespace}
+		Eventually(func() string {
+			connObj := &awiv1alpha1.InterNetworkDomainConnection{}
+			if err := k8sClient.Get(ctx, lookupKey, connObj); err != nil {
+				return ""
+			}
+			return connObj.Status.ConnectionId
+		}, 10*time.Second, 250*time.Millisecond).Should(Equal(undeletableConnectionID))
+
+		By("removing object while AWI rejects disconnect")
+		Expect(k8sClient.Delete(ctx, connSvc)).Should(Succeed())
+		Eventually(func() bool {
+			connObj := &awiv1alpha1.InterNetworkDomainConnection{}
+			if err := k8sClient.Get(ctx, lookupKey, connObj); err != nil {
+				return false
+			}
+			return meta.IsStatusConditionTrue(connObj.Status.Conditions, awiv1alpha1.ConditionDisconnectFailed)
+		}, 10*time.Second, 250*time.Millisecond).Should(BeTrue())
+
+		By("accepting disconnect")
+		mockConnectionController = awiMock.NewConnectionControllerClient(t)
+		mockConnectionController.EXPECT().
+			Disconnect(mock.Anything, mock.Anything).
+			Return(&awi.DisconnectResponse{}, nil)
+		awiTestClient.ConnectionControllerClient = mockConnectionController
+		Eventually(func() bool {
+			err := k8sClient.Get(ctx, lookupKey, &awiv1alpha1.InterNetworkDomainConnection{})
+			return apierrors.IsNotFound(err)
+		}, 30*time.Second, 250*time.Millisecond).Should(BeTrue())
+	})
+	It("should store ID of connection created by older version instead of connecting again", func() {
+		const (
+			legacyConnectionName = "legacy-connection"
+			legacyConnectionID   = "legacy-connection-id"
+		)
+
+		t := GinkgoT()
+		// no connect expected, the connection is found by spec
+		mockConnectionController := awiMock.NewConnectionControllerClient(t)
+		awiTestClient.ConnectionControllerClient = mockConnectionController
+		mockConnectionController.EXPECT().
+			ListConnections(mock.Anything, mock.Anything).
+			Return(&awi.ListConnectionsResponse{
+				Connections: []*awi.ConnectionInformation{
+					{
+						// created by the operator for another object
+						Id: "other-connection-id",
+						Metadata: &awi.ConnectionMetadata{
+							Name:   legacyConnectionName,
+							Labels: map[string]string{awiCl.OwnerUIDLabel: "other-uid"},
+						},
+						Status: awi.Status_SUCCESS,
+					},
+					{
+						Id:       legacyConnectionID,
+						Metadata: &awi.ConnectionMetadata{Name: legacyConnectionName},
+						Status:   awi.Status_SUCCESS,
+					},
+				},
+			}, nil)
+		mockConnectionController.EXPECT().
+			Disconnect(mock.Anything, mock.Anything).
+			Return(&awi.DisconnectResponse{}, nil).
+			Maybe()
+
+		// objects reconciled by older versions have the finalizer, but no ID
+		connSvc := &awiv1alpha1.InterNetworkDomainConnection{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:       legacyConnectionName,
+				Namespace:  namespace,
+				Finalizers: []string{"internetworkdomainconnection.awi.app-net-interface.io/finalizer"},
+			},
+			Spec: awiv1alpha1.InterNetworkDomainConnectionSpec{
+				ConnectionRequest: awi.ConnectionRequest{
+					Metadata: &awi.ConnectionMetadata{Name: legacyConnectionName},
+				},
+			},
+		}
+		Expect(k8sClient.Create(ctx, connSvc)).Should(Succeed())
+
+		lookupKey := types.NamespacedName{Name: legacyConnectionName, Namespace: namespace}
+		Eventually(func() string {
+			connObj := &awiv1alpha1.InterNetworkDomainConnection{}
+			if err := k8sClient.Get(ctx, lookupKey, connObj); err != nil {
+				return ""
+			}
+			return connObj.Status.ConnectionId
+		}, 10*time.Second, 250*time.Millisecond).Should(Equal(legacyConnectionID))
+
+		Expect(k8sClient.Delete(ctx, connSvc)).Should(Succeed())
+		Eventually(func() bool {
+			err := k8sClient.Get(ctx, lookupKey, &awiv1alpha1.InterNetworkDomainConnection{})
+			return apierrors.IsNotFound(err)
+		}, 10*time.Second, 250*time.Millisecond).Should(BeTrue())
+	})
 })
@@ -0,0 +1,341 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	awiv1alpha1 "app-net-interface.io/kube-awi/api/awi/v1alpha1"
+	"app-net-interface.io/kube-awi/pkg/tracing"
+	awipb "github.com/app-net-interface/awi-grpc/pb"
+)
+
+const (
+	// NetworkPolicyEnabledLabel opts a NetworkPolicy in for translation into app connections
+	NetworkPolicyEnabledLabel = "awi.app-net-interface.io/enabled"
+	// NetworkDomainConnectionAnnotation names the network domain connection generated
+	// app connections are created in
+	NetworkDomainConnectionAnnotation = "awi.app-net-interface.io/network-domain-connection"
+	// NetworkPolicyOwnerLabel is set on objects generated from a NetworkPolicy
+	NetworkPolicyOwnerLabel = "awi.app-net-interface.io/network-policy"
+)
+
+// NetworkPolicyReconciler translates egress rules of labelled NetworkPolicies
+// which target discovered subnets into InterNetworkDomainAppConnections
+type NetworkPolicyReconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+//+kubebuilder:rbac:groups=networking.k8s.io,resources=networkpolicies,verbs=get;list;watch
+//+kubebuilder:rbac:groups=awi.app-net-interface.io,resources=subnets,verbs=get;list;watch
+
+func (r *NetworkPolicyReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	logger.Info("Request received", "req:", req.String())
+
+	var policy networkingv1.NetworkPolicy
+	if err := r.Get(ctx, req.NamespacedName, &policy); err != nil {
+		// generated objects of removed policies are garbage collected thanks to owner references
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	var appConnections []*awiv1alpha1.InterNetworkDomainAppConnection
+	var accessPolicies []*awiv1alpha1.AccessPolicy
+	if policy.GetLabels()[NetworkPolicyEnabledLabel] == "true" && policy.ObjectMeta.DeletionTimestamp.IsZero() {
+		var err error
+		appConnections, accessPolicies, err = r.translate(ctx, &policy)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	for _, accessPolicy := range accessPolicies {
+		if err := r.applyAccessPolicy(ctx, &policy, accessPolicy); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	if err := syncOwnedAppConnections(ctx, r.Client, r.Scheme, &policy, NetworkPolicyOwnerLabel, appConnections); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, r.removeStaleAccessPolicies(ctx, &policy, accessPolicies)
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *NetworkPolicyReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	hasLabel := func(obj client.Object) bool {
+		_, ok := obj.GetLabels()[NetworkPolicyEnabledLabel]
+		return ok
+	}
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&networkingv1.NetworkPolicy{}, builder.WithPredicates(predicate.Funcs{
+			CreateFunc: func(e event.CreateEvent) bool {
+				return hasLabel(e.Object)
+			},
+			UpdateFunc: func(e event.UpdateEvent) bool {
+				// removing the label has to clean up generated objects
+				return hasLabel(e.ObjectOld) || hasLabel(e.ObjectNew)
+			},
+			DeleteFunc: func(e event.DeleteEvent) bool {
+				// generated objects are removed by garbage collector
+				return false
+			},
+			GenericFunc: func(e event.GenericEvent) bool {
+				return hasLabel(e.Object)
+			},
+		})).
+		Owns(&awiv1alpha1.InterNetworkDomainAppConnection{}).
+		Owns(&awiv1alpha1.AccessPolicy{}).
+		// discovered subnets decide which ipBlocks are translated
+		Watches(&awiv1alpha1.Subnet{},
+			handler.EnqueueRequestsFromMapFunc(r.translatedNetworkPolicies)).
+		Complete(tracing.Reconciler("NetworkPolicy", r))
+}
+
+func (r *NetworkPolicyReconciler) translatedNetworkPolicies(ctx context.Context, _ client.Object) []reconcile.Request {
+	var policyList networkingv1.NetworkPolicyList
+	if err := r.List(ctx, &policyList, client.MatchingLabels{NetworkPolicyEnabledLabel: "true"}); err != nil {
+		log.FromContext(ctx).Error(err, "failed to list NetworkPolicies")
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(policyList.Items))
+	for _, policy := range policyList.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{
+			Namespace: policy.GetNamespace(),
+			Name:      policy.GetName(),
+		}})
+	}
+	return requests
+}
+
+// translate builds app connections and access policies for egress rules whose
+// ipBlocks overlap with discovered subnets. Peers selecting pods or namespaces
+// describe in-cluster traffic and are skipped.
+func (r *NetworkPolicyReconciler) translate(ctx context.Context, policy *networkingv1.NetworkPolicy) (
+	[]*awiv1alpha1.InterNetworkDomainAppConnection, []*awiv1alpha1.AccessPolicy, error) {
+	logger := log.FromContext(ctx)
+
+	networkDomainConnection := policy.GetAnnotations()[NetworkDomainConnectionAnnotation]
+	if networkDomainConnection == "" {
+		logger.Info("NetworkPolicy has no network domain connection annotation, skipping",
+			"namespace", policy.GetNamespace(), "name", policy.GetName(),
+			"annotation", NetworkDomainConnectionAnnotation)
+		return nil, nil, nil
+	}
+
+	var subnetList awiv1alpha1.SubnetList
+	if err := r.List(ctx, &subnetList); err != nil {
+		return nil, nil, err
+	}
+	var discovered []*net.IPNet
+	for _, subnet := range subnetList.Items {
+		_, cidr, err := net.ParseCIDR(subnet.Spec.GetCidrBlock())
+		if err != nil {
+			continue
+		}
+		discovered = append(discovered, cidr)
+	}
+
+	var appConnections []*awiv1alpha1.InterNetworkDomainAppConnection
+	var accessPolicies []*awiv1alpha1.AccessPolicy
+	for i, rule := range policy.Spec.Egress {
+		var prefixes []string
+		for _, peer := range rule.To {
+			if peer.IPBlock == nil {
+				continue
+			}
+			if len(peer.IPBlock.Except) > 0 {
+				// AWI subnet selector can't express exceptions, translating the
+				// block would allow more than the policy does
+				logger.Info("Skipping ipBlock with exceptions", "cidr", peer.IPBlock.CIDR)
+				continue
+			}
+			_, cidr, err := net.ParseCIDR(peer.IPBlock.CIDR)
+			if err != nil || !overlapsAny(cidr, discovered) {
+				continue
+			}
+			prefixes = append(prefixes, peer.IPBlock.CIDR)
+		}
+		if len(prefixes) == 0 {
+			continue
+		}
+
+		appConnection := awipb.AppConnection{
+			NetworkDomainConnection: &awipb.NetworkDomainConnection{
+				Selector: &awipb.NetworkDomainConnection_Selector{MatchName: networkDomainConnection},
+			},
+			From: &awipb.From{
+				Endpoint: &awipb.Endpoint{
+					Kind: "pod",
+					Selector: &awipb.Endpoint_Selector{
+						MatchLabels:      policy.Spec.PodSelector.MatchLabels,
+						MatchExpressions: toMatchExpressions(policy.Spec.PodSelector.MatchExpressions),
+						MatchNamespace:   &awipb.MatchNamespace{Name: policy.GetNamespace()},
+					},
+				},
+			},
+			To: &awipb.To{
+				Subnet: &awipb.AppSubnet{
+					Selector: &awipb.AppSubnet_Selector{MatchPrefix: prefixes},
+				},
+			},
+		}
+
+		if len(rule.Ports) > 0 {
+			rules, err := toAccessPolicyRules(rule.Ports)
+			if err != nil {
+				logger.Info("Skipping egress rule which can't be translated", "rule", i, "reason", err.Error())
+				continue
+			}
+			accessPolicy := &awiv1alpha1.AccessPolicy{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      fmt.Sprintf("%s-egress-%d", truncateName(policy.GetName()), i),
+					Namespace: policy.GetNamespace(),
+				},
+				Spec: awiv1alpha1.AccessPolicySpec{
+					Description: fmt.Sprintf("Generated from NetworkPolicy %s/%s", policy.GetNamespace(), policy.GetName()),
+					AccessType:  awipb.AccessType_ALLOW.String(),
+					Direction:   awipb.Direction_EGRESS.String(),
+					Rules:       rules,
+				},
+			}
+			accessPolicies = append(accessPolicies, accessPolicy)
+			appConnection.AccessPolicy = &awipb.AccessPolicySelector{
+				Selector: &awipb.AccessPolicySelector_Selector{
+					MatchName: &awipb.AccessPolicySelector_MatchName{Name: accessPolicy.GetName()},
+				},
+			}
+		}
+
+		appConnections = append(appConnections, generatedAppConnection(policy, "NetworkPolicy", &appConnection))
+	}
+	return appConnections, accessPolicies, nil
+}
+
+func (r *NetworkPolicyReconciler) applyAccessPolicy(ctx context.Context, policy *networkingv1.NetworkPolicy,
+	desired *awiv1alpha1.AccessPolicy) error {
+	accessPolicy := &awiv1alpha1.AccessPolicy{ObjectMeta: metav1.ObjectMeta{
+		Name:      desired.GetName(),
+		Namespace: desired.GetNamespace(),
+	}}
+	_, err := controllerutil.CreateOrUpdate(ctx, r.Client, accessPolicy, func() error {
+		// the name could be taken by a policy created by the user
+		if accessPolicy.GetResourceVersion() != "" && !metav1.IsControlledBy(accessPolicy, policy) {
+			return fmt.Errorf("AccessPolicy %s/%s exists and isn't owned by NetworkPolicy %s",
+				accessPolicy.GetNamespace(), accessPolicy.GetName(), policy.GetName())
+		}
+		if accessPolicy.Labels == nil {
+			accessPolicy.Labels = map[string]string{}
+		}
+		accessPolicy.Labels[NetworkPolicyOwnerLabel] = policy.GetName()
+		accessPolicy.Spec = desired.Spec
+		return controllerutil.SetControllerReference(policy, accessPolicy, r.Scheme)
+	})
+	return err
+}
+
+func (r *NetworkPolicyReconciler) removeStaleAccessPolicies(ctx context.Context, policy *networkingv1.NetworkPolicy,
+	desired []*awiv1alpha1.AccessPolicy) error {
+	var existingList awiv1alpha1.AccessPolicyList
+	err := r.List(ctx, &existingList, client.InNamespace(policy.GetNamespace()),
+		client.MatchingLabels{NetworkPolicyOwnerLabel: policy.GetName()})
+	if err != nil {
+		return err
+	}
+	desiredNames := make(map[string]struct{}, len(desired))
+	for _, accessPolicy := range desired {
+		desiredNames[accessPolicy.GetName()] = struct{}{}
+	}
+	for i := range existingList.Items {
+		if _, ok := desiredNames[existingList.Items[i].GetName()]; ok {
+			continue
+		}
+		if !metav1.IsControlledBy(&existingList.Items[i], policy) {
+			// the owner label was set by the user
+			continue
+		}
+		log.FromContext(ctx).Info("Removing AccessPolicy CRD", "name", existingList.Items[i].GetName())
+		if err := r.Delete(ctx, &existingList.Items[i]); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func toMatchExpressions(requirements []metav1.LabelSelectorRequirement) []*awipb.MatchExpression {
+	var expressions []*awipb.MatchExpression
+	for _, requirement := range requirements {
+		expressions = append(expressions, &awipb.MatchExpression{
+			Key:      requirement.Key,
+			Operator: string(requirement.Operator),
+			Values:   requirement.Values,
+		})
+	}
+	return expressions
+}
+
+func toAccessPolicyRules(ports []networkingv1.NetworkPolicyPort) ([]awiv1alpha1.AccessPolicyRule, error) {
+	rules := make([]awiv1alpha1.AccessPolicyRule, 0, len(ports))
+	for _, port := range ports {
+		protocol := corev1.ProtocolTCP
+		if port.Protocol != nil {
+			protocol = *port.Protocol
+		}
+		if protocol == corev1.ProtocolSCTP {
+			return nil, fmt.Errorf("protocol %s is not supported", protocol)
+		}
+		rule := awiv1alpha1.AccessPolicyRule{Protocol: string(protocol)}
+		if port.Port != nil {
+			if port.Port.Type != intstr.Int {
+				return nil, fmt.Errorf("named port %s is not supported", port.Port.StrVal)
+			}
+			rule.Port = fmt.Sprintf("%d", port.Port.IntVal)
+			if port.EndPort != nil {
+				rule.Port = fmt.Sprintf("%d-%d", port.Port.IntVal, *port.EndPort)
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func overlapsAny(cidr *net.IPNet, subnets []*net.IPNet) bool {
+	for _, subnet := range subnets {
+		if subnet.Contains(cidr.IP) || cidr.Contains(subnet.IP) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,237 @@
+// Copyright (c) 2023 Cisco Systems, Inc. and its affiliates
+// All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http:www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+// +kubebuilder:docs-gen:collapse=Apache License
+
+package controllers
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	awiv1alpha1 "app-net-interface.io/kube-awi/api/awi/v1alpha1"
+	awiMock "github.com/app-net-interface/awi-grpc/mocks"
+	awi "github.com/app-net-interface/awi-grpc/pb"
+)
+
+var _ = Describe("NetworkPolicy Controller", func() {
+	const (
+		namespace         = "default"
+		networkPolicyName = "db-egress"
+		timeout           = 10 * time.Second
+		interval          = 250 * time.Millisecond
+	)
+
+	It("should translate egress rules targeting discovered subnets into app connections", func() {
+		t := GinkgoT()
+		mockAppConnectionController := awiMock.NewAppConnectionControllerClient(t)
+		mockAppConnectionController.EXPECT().ConnectApps(mock.Anything, mock.Anything).
+			Return(&awi.AppConnectionResponse{}, nil).Maybe()
+		mockAppConnectionController.EXPECT().ListConnectedApps(mock.Anything, mock.Anything).
+			Return(&awi.ListAppConnectionsResponse{}, nil).Maybe()
+		awiTestClient.AppConnectionControllerClient = mockAppConnectionController
+		mockSecurityPolicyClient := awiMock.NewSecurityPolicyServiceClient(t)
+		mockSecurityPolicyClient.EXPECT().CreateAccessPolicy(mock.Anything, mock.Anything).
+			Return(&awi.AccessPolicyCreateResponse{Status: awi.Status_SUCCESS}, nil).Maybe()
+		mockSecurityPolicyClient.EXPECT().DeleteAccessPolicy(mock.Anything, mock.Anything).
+			Return(&awi.AccessPolicyDeleteResponse{}, nil).Maybe()
+		awiTestClient.SecurityPolicyClient = mockSecurityPolicyClient
+
+		subnet := &awiv1alpha1.Subnet{
+			ObjectMeta: metav1.ObjectMeta{Name: "aws.subnet-db", Namespace: namespace},
+			Spec: awi.Subnet{
+				SubnetId:  "subnet-db",
+				CidrBlock: "10.10.1.0/24",
+				VpcId:     "vpc-db",
+			},
+		}
+		Expect(k8sClient.Create(ctx, subnet)).Should(Succeed())
+
+		tcp := corev1.ProtocolTCP
+		port := intstr.FromInt(5432)
+		networkPolicy := &networkingv1.NetworkPolicy{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        networkPolicyName,
+				Namespace:   namespace,
+				Labels:      map[string]string{NetworkPolicyEnabledLabel: "true"},
+				Annotations: map[string]string{NetworkDomainConnectionAnnotation: "vpc-app:vpc-db"},
+			},
+			Spec: networkingv1.NetworkPolicySpec{
+				PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "backend"}},
+				PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+				Egress: []networkingv1.NetworkPolicyEgressRule{
+					{
+						Ports: []networkingv1.NetworkPolicyPort{{Protocol: &tcp, Port: &port}},
+						To: []networkingv1.NetworkPolicyPeer{
+							{IPBlock: &networkingv1.IPBlock{CIDR: "10.10.0.0/16"}},
+							// not discovered, should be skipped
+							{IPBlock: &networkingv1.IPBlock{CIDR: "192.168.0.0/16"}},
+						},
+					},
+					{
+						// in-cluster traffic, should be skipped
+						To: []networkingv1.NetworkPolicyPeer{
+							{PodSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "cache"}}},
+						},
+					},
+				},
+			},
+		}
+		Expect(k8sClient.Create(ctx, networkPolicy)).Should(Succeed())
+
+		ownedBy := client.MatchingLabels{NetworkPolicyOwnerLabel: networkPolicyName}
+		var appConnections awiv1alpha1.InterNetworkDomainAppConnectionList
+		Eventually(func() int {
+			if err := k8sClient.List(ctx, &appConnections, client.InNamespace(namespace), ownedBy); err != nil {
+				return -1
+			}
+			return len(appConnections.Items)
+		}, timeout, interval).Should(Equal(1))
+
+		appConnection := appConnections.Items[0].Spec.AppConnection
+		Expect(appConnection.GetTo().GetSubnet().GetSelector().GetMatchPrefix()).To(Equal([]string{"10.10.0.0/16"}))
+		Expect(appConnection.GetFrom().GetEndpoint().GetSelector().GetMatchLabels()).To(Equal(map[string]string{"app": "backend"}))
+		Expect(appConnection.GetNetworkDomainConnection().GetSelector().GetMatchName()).To(Equal("vpc-app:vpc-db"))
+		Expect(appConnections.Items[0].GetOwnerReferences()).To(HaveLen(1))
+
+		accessPolicy := &awiv1alpha1.AccessPolicy{}
+		accessPolicyKey := types.NamespacedName{
+			Name:      appConnection.GetAccessPolicy().GetSelector().GetMatchName().GetName(),
+			Namespace: namespace,
+		}
+		Expect(k8sClient.Get(ctx, accessPolicyKey, accessPolicy)).Should(Succeed())
+		Expect(accessPolicy.Spec.Rules).To(Equal([]awiv1alpha1.AccessPolicyRule{{Protocol: "TCP", Port: "5432"}}))
+
+		By("removing the label generated objects should be removed")
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Name: networkPolicyName, Namespace: namespace}, networkPolicy)).Should(Succeed())
+		networkPolicy.Labels = nil
+		Expect(k8sClient.Update(ctx, networkPolicy)).Should(Succeed())
+		Eventually(func() int {
+			if err := k8sClient.List(ctx, &appConnections, client.InNamespace(namespace), ownedBy); err != nil {
+				return -1
+			}
+			return len(appConnections.Items)
+		}, timeout, interval).Should(Equal(0))
+	})
+
+	It("shouldn't take over access policy created by the user", func() {
+		const conflictingPolicyName = "conflicting-egress"
+
+		t := GinkgoT()
+		mockSecurityPolicyClient := awiMock.NewSecurityPolicyServiceClient(t)
+		mockSecurityPolicyClient.EXPECT().CreateAccessPolicy(mock.Anything, mock.Anything).
+			Return(&awi.AccessPolicyCreateResponse{Status: awi.Status_SUCCESS}, nil).Maybe()
+		mockSecurityPolicyClient.EXPECT().DeleteAccessPolicy(mock.Anything, mock.Anything).
+			Return(&awi.AccessPolicyDeleteResponse{}, nil).Maybe()
+		awiTestClient.SecurityPolicyClient = mockSecurityPolicyClient
+
+		subnet := &awiv1alpha1.Subnet{
+			ObjectMeta: metav1.ObjectMeta{Name: "aws.subnet-conflicting", Namespace: namespace},
+			Spec: awi.Subnet{
+				SubnetId:  "subnet-conflicting",
+				CidrBlock: "10.20.1.0/24",
+				VpcId:     "vpc-conflicting",
+			},
+		}
+		Expect(k8sClient.Create(ctx, subnet)).Should(Succeed())
+
+		// named as the policy generated for the first egress rule
+		userPolicy := &awiv1alpha1.AccessPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: conflictingPolicyName + "-egress-0", Namespace: namespace},
+			Spec: awiv1alpha1.AccessPolicySpec{
+				AccessType: "DENY",
+				Direction:  "EGRESS",
+				Rules:      []awiv1alpha1.AccessPolicyRule{{Protocol: "ICMP"}},
+			},
+		}
+		Expect(k8sClient.Create(ctx, userPolicy)).Should(Succeed())
+
+		tcp := corev1.ProtocolTCP
+		port := intstr.FromInt(443)
+		networkPolicy := &networkingv1.NetworkPolicy{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        conflictingPolicyName,
+				Namespace:   namespace,
+				Labels:      map[string]string{NetworkPolicyEnabledLabel: "true"},
+				Annotations: map[string]string{NetworkDomainConnectionAnnotation: "vpc-app:vpc-conflicting"},
+			},
+			Spec: networkingv1.NetworkPolicySpec{
+				PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "frontend"}},
+				PolicyTypes: []networkingv1.PolicyType{networkingv1.PolicyTypeEgress},
+				Egress: []networkingv1.NetworkPolicyEgressRule{
+					{
+						Ports: []networkingv1.NetworkPolicyPort{{Protocol: &tcp, Port: &port}},
+						To:    []networkingv1.NetworkPolicyPeer{{IPBlock: &networkingv1.IPBlock{CIDR: "10.20.0.0/16"}}},
+					},
+				},
+			},
+		}
+		Expect(k8sClient.Create(ctx, networkPolicy)).Should(Succeed())
+
+		policyKey := types.NamespacedName{Name: userPolicy.GetName(), Namespace: namespace}
+		Consistently(func() bool {
+			policy := &awiv1alpha1.AccessPolicy{}
+			if err := k8sClient.Get(ctx, policyKey, policy); err != nil {
+				return false
+			}
+			return len(policy.GetOwnerReferences()) == 0 && policy.Spec.AccessType == "DENY"
+		}, 2*time.Second, interval).Should(BeTrue())
+		var appConnections awiv1alpha1.InterNetworkDomainAppConnectionList
+		Expect(k8sClient.List(ctx, &appConnections, client.InNamespace(namespace),
+			client.MatchingLabels{NetworkPolicyOwnerLabel: conflictingPolicyName})).Should(Succeed())
+		Expect(appConnections.Items).To(BeEmpty())
+
+		Expect(k8sClient.Delete(ctx, networkPolicy)).Should(Succeed())
+		Expect(k8sClient.Delete(ctx, userPolicy)).Should(Succeed())
+	})
+
+	It("should translate port ranges and reject named ports", func() {
+		udp := corev1.ProtocolUDP
+		from := intstr.FromInt(8000)
+		to := int32(8080)
+		rules, err := toAccessPolicyRules([]networkingv1.NetworkPolicyPort{{Protocol: &udp, Port: &from, EndPort: &to}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rules).To(Equal([]awiv1alpha1.AccessPolicyRule{{Protocol: "UDP", Port: "8000-8080"}}))
+
+		named := intstr.FromString("http")
+		_, err = toAccessPolicyRules([]networkingv1.NetworkPolicyPort{{Port: &named}})
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,110 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	awiv1alpha1 "app-net-interface.io/kube-awi/api/awi/v1alpha1"
+	awipb "github.com/app-net-interface/awi-grpc/pb"
+)
+
+// syncOwnedAppConnections makes app connections generated for the owner match
+// the desired ones. Generated objects are found by ownerLabel set to the
+// owner's name, missing ones are created and the rest is removed.
+func syncOwnedAppConnections(ctx context.Context, k8sClient client.Client, scheme *runtime.Scheme,
+	owner client.Object, ownerLabel string, desired []*awiv1alpha1.InterNetworkDomainAppConnection) error {
+	logger := log.FromContext(ctx)
+
+	var existingList awiv1alpha1.InterNetworkDomainAppConnectionList
+	err := k8sClient.List(ctx, &existingList, client.InNamespace(owner.GetNamespace()),
+		client.MatchingLabels{ownerLabel: owner.GetName()})
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]*awiv1alpha1.InterNetworkDomainAppConnection, len(existingList.Items))
+	for i := range existingList.Items {
+		existing[existingList.Items[i].GetName()] = &existingList.Items[i]
+	}
+
+	for _, appConnection := range desired {
+		if _, ok := existing[appConnection.GetName()]; ok {
+			delete(existing, appConnection.GetName())
+			continue
+		}
+		appConnection.Labels = map[string]string{ownerLabel: owner.GetName()}
+		if err := controllerutil.SetControllerReference(owner, appConnection, scheme); err != nil {
+			return err
+		}
+		logger.Info("Adding new InterNetworkDomainAppConnection CRD", "name", appConnection.GetName())
+		if err := k8sClient.Create(ctx, appConnection); err != nil {
+			return err
+		}
+	}
+
+	// all still desired were removed from map, we delete the rest
+	for _, appConnection := range existing {
+		logger.Info("Removing InterNetworkDomainAppConnection CRD", "name", appConnection.GetName())
+		if err := k8sClient.Delete(ctx, appConnection); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// generatedAppConnection wraps the spec into a CRD. App connection can't be
+// updated, so its name is derived from the spec, and any change results in
+// a new object replacing the old one.
+func generatedAppConnection(owner client.Object, ownerKind string,
+	spec *awipb.AppConnection) *awiv1alpha1.InterNetworkDomainAppConnection {
+	name := fmt.Sprintf("%s-%s", truncateName(owner.GetName()), specHash(spec))
+	spec.Metadata = &awipb.AppMetadata{
+		Name:        name,
+		Description: fmt.Sprintf("Generated from %s %s/%s", ownerKind, owner.GetNamespace(), owner.GetName()),
+	}
+	appConnection := &awiv1alpha1.InterNetworkDomainAppConnection{
+		Spec: awiv1alpha1.AppConnectionSpec{AppConnection: *spec},
+	}
+	appConnection.SetName(name)
+	appConnection.SetNamespace(owner.GetNamespace())
+	return appConnection
+}
+
+func specHash(appConnection *awipb.AppConnection) string {
+	// json sorts map keys, so the output is stable
+	data, _ := json.Marshal(appConnection)
+	hash := fnv.New32a()
+	_, _ = hash.Write(data)
+	return fmt.Sprintf("%08x", hash.Sum32())
+}
+
+// truncateName leaves room for suffixes added to generated object names
+func truncateName(name string) string {
+	const maxLength = 50
+	if len(name) > maxLength {
+		return name[:maxLength]
+	}
+	return name
+}
@@ -0,0 +1,167 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"net/netip"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	awiv1alpha1 "app-net-interface.io/kube-awi/api/awi/v1alpha1"
+	awipb "github.com/app-net-interface/awi-grpc/pb"
+)
+
+// DefaultEndpointsDebounce is the minimal time between two updates of
+// resolved pod endpoints sent to AWI for a single app connection
+const DefaultEndpointsDebounce = 10 * time.Second
+
+// podSelectorOf returns the namespace and selector of pods matching
+// from.endpoint of the app connection. Only pods from the local cluster
+// can be resolved.
+func podSelectorOf(conn *awiv1alpha1.InterNetworkDomainAppConnection, clusterName string) (string, labels.Selector, bool) {
+	endpoint := conn.Spec.AppConnection.GetFrom().GetEndpoint()
+	if !strings.EqualFold(endpoint.GetKind(), "pod") {
+		return "", nil, false
+	}
+	if cluster := endpoint.GetSelector().GetMatchCluster().GetName(); cluster != "" && cluster != clusterName {
+		return "", nil, false
+	}
+	if len(endpoint.GetSelector().GetMatchLabels()) == 0 && len(endpoint.GetSelector().GetMatchExpressions()) == 0 {
+		return "", nil, false
+	}
+	selector, err := metav1.LabelSelectorAsSelector(&metav1.LabelSelector{
+		MatchLabels:      endpoint.GetSelector().GetMatchLabels(),
+		MatchExpressions: fromMatchExpressions(endpoint.GetSelector().GetMatchExpressions()),
+	})
+	if err != nil {
+		// selector is passed to AWI as is and will be validated there
+		return "", nil, false
+	}
+	namespace := endpoint.GetSelector().GetMatchNamespace().GetName()
+	if namespace == "" {
+		namespace = conn.GetNamespace()
+	}
+	return namespace, selector, true
+}
+
+// resolvePodEndpoints returns sorted IPs of running pods matching the selector
+func resolvePodEndpoints(ctx context.Context, k8sClient client.Client, namespace string,
+	selector labels.Selector) ([]string, error) {
+	var pods corev1.PodList
+	err := k8sClient.List(ctx, &pods, client.InNamespace(namespace), client.MatchingLabelsSelector{Selector: selector})
+	if err != nil {
+		return nil, err
+	}
+	ips := map[string]struct{}{}
+	for _, pod := range pods.Items {
+		if !pod.GetDeletionTimestamp().IsZero() || pod.Status.Phase != corev1.PodRunning {
+			continue
+		}
+		for _, podIP := range pod.Status.PodIPs {
+			ips[podIP.IP] = struct{}{}
+		}
+		if pod.Status.PodIP != "" {
+			ips[pod.Status.PodIP] = struct{}{}
+		}
+	}
+	resolved := make([]string, 0, len(ips))
+	for ip := range ips {
+		resolved = append(resolved, ip)
+	}
+	sort.Strings(resolved)
+	return resolved, nil
+}
+
+// podEndpointsAppConnection returns a copy of the app connection with the
+// source replaced by prefixes of resolved pod IPs. AWI endpoint selectors
+// have no field for IPs, subnet prefixes are what AWI matches traffic by.
+func podEndpointsAppConnection(appConnection *awipb.AppConnection, ips []string) *awipb.AppConnection {
+	resolved := proto.Clone(appConnection).(*awipb.AppConnection)
+	prefixes := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		addr, err := netip.ParseAddr(ip)
+		if err != nil {
+			continue
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()).String())
+	}
+	resolved.From.Endpoint = nil
+	resolved.From.Subnet = &awipb.AppSubnet{
+		Selector: &awipb.AppSubnet_Selector{MatchPrefix: prefixes},
+	}
+	return resolved
+}
+
+func fromMatchExpressions(expressions []*awipb.MatchExpression) []metav1.LabelSelectorRequirement {
+	var requirements []metav1.LabelSelectorRequirement
+	for _, expression := range expressions {
+		requirements = append(requirements, metav1.LabelSelectorRequirement{
+			Key:      expression.GetKey(),
+			Operator: metav1.LabelSelectorOperator(expression.GetOperator()),
+			Values:   expression.GetValues(),
+		})
+	}
+	return requirements
+}
+
+// podEndpointsChanged passes only pod events which can change resolved endpoints
+var podEndpointsChanged = predicate.Funcs{
+	UpdateFunc: func(e event.UpdateEvent) bool {
+		oldPod, okOld := e.ObjectOld.(*corev1.Pod)
+		newPod, okNew := e.ObjectNew.(*corev1.Pod)
+		if !okOld || !okNew {
+			return false
+		}
+		return !labels.Equals(oldPod.GetLabels(), newPod.GetLabels()) ||
+			oldPod.Status.Phase != newPod.Status.Phase ||
+			oldPod.Status.PodIP != newPod.Status.PodIP ||
+			len(oldPod.Status.PodIPs) != len(newPod.Status.PodIPs) ||
+			oldPod.GetDeletionTimestamp().IsZero() != newPod.GetDeletionTimestamp().IsZero()
+	},
+}
+
+// appConnectionsForPod enqueues app connections with from.endpoint selecting
+// the pod, so resolved endpoints follow pods being rescheduled.
+func (r *AppConnectionReconciler) appConnectionsForPod(ctx context.Context, pod client.Object) []reconcile.Request {
+	var connList awiv1alpha1.InterNetworkDomainAppConnectionList
+	if err := r.List(ctx, &connList); err != nil {
+		log.FromContext(ctx).Error(err, "failed to list InterNetworkDomainAppConnection CRDs")
+		return nil
+	}
+	var requests []reconcile.Request
+	for i := range connList.Items {
+		conn := &connList.Items[i]
+		namespace, selector, ok := podSelectorOf(conn, r.ClusterName)
+		if !ok || namespace != pod.GetNamespace() || !selector.Matches(labels.Set(pod.GetLabels())) {
+			continue
+		}
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(conn)})
+	}
+	return requests
+}
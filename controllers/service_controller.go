@@ -0,0 +1,181 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	awiv1alpha1 "app-net-interface.io/kube-awi/api/awi/v1alpha1"
+	"app-net-interface.io/kube-awi/pkg/tracing"
+	awipb "github.com/app-net-interface/awi-grpc/pb"
+)
+
+const (
+	// ServiceAllowedClientsAnnotation holds a label selector, e.g. "app=frontend",
+	// of pods which should be able to reach the annotated Service
+	ServiceAllowedClientsAnnotation = "awi.app-net-interface.io/allowed-clients"
+	// ServiceAllowedClientsClusterAnnotation optionally names the cluster of allowed
+	// client pods, the cluster of the operator is used if not set
+	ServiceAllowedClientsClusterAnnotation = "awi.app-net-interface.io/allowed-clients-cluster"
+	// ServiceAccessPolicyAnnotation optionally names the AccessPolicy of the generated connection
+	ServiceAccessPolicyAnnotation = "awi.app-net-interface.io/access-policy"
+	// ServiceOwnerLabel is set on app connections generated for a Service
+	ServiceOwnerLabel = "awi.app-net-interface.io/service"
+)
+
+// ServiceReconciler creates InterNetworkDomainAppConnections for Services
+// annotated with allowed clients
+type ServiceReconciler struct {
+	client.Client
+	Scheme      *runtime.Scheme
+	ClusterName string
+}
+
+//+kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch
+
+func (r *ServiceReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+	logger.Info("Request received", "req:", req.String())
+
+	var service corev1.Service
+	if err := r.Get(ctx, req.NamespacedName, &service); err != nil {
+		// generated objects of removed services are garbage collected thanks to owner references
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	var appConnections []*awiv1alpha1.InterNetworkDomainAppConnection
+	if _, ok := service.GetAnnotations()[ServiceAllowedClientsAnnotation]; ok && service.ObjectMeta.DeletionTimestamp.IsZero() {
+		appConnection, err := r.appConnectionForService(&service)
+		if err != nil {
+			// annotation needs to be fixed by the user, there is no point in retrying
+			logger.Info("Service app connection can't be created", "namespace", req.Namespace,
+				"name", req.Name, "reason", err.Error())
+		} else {
+			appConnections = append(appConnections, appConnection)
+		}
+	}
+	return ctrl.Result{}, syncOwnedAppConnections(ctx, r.Client, r.Scheme, &service, ServiceOwnerLabel, appConnections)
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *ServiceReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	hasAnnotation := func(obj client.Object) bool {
+		_, ok := obj.GetAnnotations()[ServiceAllowedClientsAnnotation]
+		return ok
+	}
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&corev1.Service{}, builder.WithPredicates(predicate.Funcs{
+			CreateFunc: func(e event.CreateEvent) bool {
+				return hasAnnotation(e.Object)
+			},
+			UpdateFunc: func(e event.UpdateEvent) bool {
+				// removing the annotation has to clean up generated objects
+				return hasAnnotation(e.ObjectOld) || hasAnnotation(e.ObjectNew)
+			},
+			DeleteFunc: func(e event.DeleteEvent) bool {
+				// generated objects are removed by garbage collector
+				return false
+			},
+			GenericFunc: func(e event.GenericEvent) bool {
+				return hasAnnotation(e.Object)
+			},
+		})).
+		Owns(&awiv1alpha1.InterNetworkDomainAppConnection{}).
+		Complete(tracing.Reconciler("Service", r))
+}
+
+func (r *ServiceReconciler) appConnectionForService(service *corev1.Service) (*awiv1alpha1.InterNetworkDomainAppConnection, error) {
+	serviceType, err := awiServiceType(service.Spec.Type)
+	if err != nil {
+		return nil, err
+	}
+	networkDomainConnection := service.GetAnnotations()[NetworkDomainConnectionAnnotation]
+	if networkDomainConnection == "" {
+		return nil, fmt.Errorf("missing %s annotation", NetworkDomainConnectionAnnotation)
+	}
+	clients, err := metav1.ParseToLabelSelector(service.GetAnnotations()[ServiceAllowedClientsAnnotation])
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s annotation: %v", ServiceAllowedClientsAnnotation, err)
+	}
+	if len(clients.MatchLabels) == 0 && len(clients.MatchExpressions) == 0 {
+		return nil, fmt.Errorf("%s annotation selects no pods", ServiceAllowedClientsAnnotation)
+	}
+
+	clientSelector := &awipb.Endpoint_Selector{
+		MatchLabels:      clients.MatchLabels,
+		MatchExpressions: toMatchExpressions(clients.MatchExpressions),
+	}
+	if clientCluster := service.GetAnnotations()[ServiceAllowedClientsClusterAnnotation]; clientCluster != "" {
+		clientSelector.MatchCluster = &awipb.MatchCluster{Name: clientCluster}
+	}
+
+	appConnection := awipb.AppConnection{
+		NetworkDomainConnection: &awipb.NetworkDomainConnection{
+			Selector: &awipb.NetworkDomainConnection_Selector{MatchName: networkDomainConnection},
+		},
+		From: &awipb.From{
+			Endpoint: &awipb.Endpoint{
+				Kind:     "pod",
+				Selector: clientSelector,
+			},
+		},
+		To: &awipb.To{
+			Service: &awipb.Service{
+				Kind: &awipb.ServiceKind{
+					K8SService: &awipb.ServiceKind_K8SService{ServiceType: serviceType},
+				},
+				Selector: &awipb.Service_Selector{
+					MatchName:      &awipb.MatchName{Name: service.GetName()},
+					MatchNamespace: &awipb.MatchNamespace{Name: service.GetNamespace()},
+					MatchCluster:   &awipb.MatchCluster{Name: r.ClusterName},
+				},
+			},
+		},
+	}
+	if accessPolicy := service.GetAnnotations()[ServiceAccessPolicyAnnotation]; accessPolicy != "" {
+		appConnection.AccessPolicy = &awipb.AccessPolicySelector{
+			Selector: &awipb.AccessPolicySelector_Selector{
+				MatchName: &awipb.AccessPolicySelector_MatchName{Name: accessPolicy},
+			},
+		}
+	}
+	return generatedAppConnection(service, "Service", &appConnection), nil
+}
+
+// awiServiceType maps Service type to the one expected in k8sService.serviceType.
+// Only Services reachable from outside of the cluster can be connected.
+func awiServiceType(serviceType corev1.ServiceType) (string, error) {
+	switch serviceType {
+	case corev1.ServiceTypeLoadBalancer:
+		return "loadBalancer", nil
+	case corev1.ServiceTypeNodePort:
+		return "nodePort", nil
+	default:
+		return "", fmt.Errorf("service type %s is not reachable from other network domains", serviceType)
+	}
+}
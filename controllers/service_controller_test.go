@@ -0,0 +1,122 @@
+// Copyright (c) 2023 Cisco Systems, Inc. and its affiliates
+// All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http:www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+// +kubebuilder:docs-gen:collapse=Apache License
+
+package controllers
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	awiv1alpha1 "app-net-interface.io/kube-awi/api/awi/v1alpha1"
+	awiMock "github.com/app-net-interface/awi-grpc/mocks"
+	awi "github.com/app-net-interface/awi-grpc/pb"
+)
+
+var _ = Describe("Service Controller", func() {
+	const (
+		namespace   = "default"
+		serviceName = "dataset"
+		timeout     = 10 * time.Second
+		interval    = 250 * time.Millisecond
+	)
+
+	It("should create app connection for annotated Service and remove it with the annotation", func() {
+		t := GinkgoT()
+		mockAppConnectionController := awiMock.NewAppConnectionControllerClient(t)
+		mockAppConnectionController.EXPECT().ConnectApps(mock.Anything, mock.Anything).
+			Return(&awi.AppConnectionResponse{}, nil).Maybe()
+		mockAppConnectionController.EXPECT().ListConnectedApps(mock.Anything, mock.Anything).
+			Return(&awi.ListAppConnectionsResponse{}, nil).Maybe()
+		mockAppConnectionController.EXPECT().DisconnectApps(mock.Anything, mock.Anything).
+			Return(&awi.AppDisconnectionResponse{}, nil).Maybe()
+		awiTestClient.AppConnectionControllerClient = mockAppConnectionController
+
+		service := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      serviceName,
+				Namespace: namespace,
+				Annotations: map[string]string{
+					ServiceAllowedClientsAnnotation:   "app=ml-training-app",
+					NetworkDomainConnectionAnnotation: "vpc-app:vpc-db",
+				},
+			},
+			Spec: corev1.ServiceSpec{
+				Type:     corev1.ServiceTypeLoadBalancer,
+				Selector: map[string]string{"app": "dataset"},
+				Ports:    []corev1.ServicePort{{Port: 5432}},
+			},
+		}
+		Expect(k8sClient.Create(ctx, service)).Should(Succeed())
+
+		ownedBy := client.MatchingLabels{ServiceOwnerLabel: serviceName}
+		var appConnections awiv1alpha1.InterNetworkDomainAppConnectionList
+		Eventually(func() int {
+			if err := k8sClient.List(ctx, &appConnections, client.InNamespace(namespace), ownedBy); err != nil {
+				return -1
+			}
+			return len(appConnections.Items)
+		}, timeout, interval).Should(Equal(1))
+
+		appConnection := appConnections.Items[0].Spec.AppConnection
+		Expect(appConnection.GetTo().GetService().GetKind().GetK8SService().GetServiceType()).To(Equal("loadBalancer"))
+		Expect(appConnection.GetTo().GetService().GetSelector().GetMatchName().GetName()).To(Equal(serviceName))
+		Expect(appConnection.GetTo().GetService().GetSelector().GetMatchCluster().GetName()).To(Equal("test-cluster"))
+		Expect(appConnection.GetFrom().GetEndpoint().GetSelector().GetMatchLabels()).To(Equal(map[string]string{"app": "ml-training-app"}))
+
+		By("removing the annotation generated app connection should be removed")
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Name: serviceName, Namespace: namespace}, service)).Should(Succeed())
+		delete(service.Annotations, ServiceAllowedClientsAnnotation)
+		Expect(k8sClient.Update(ctx, service)).Should(Succeed())
+		Eventually(func() int {
+			if err := k8sClient.List(ctx, &appConnections, client.InNamespace(namespace), ownedBy); err != nil {
+				return -1
+			}
+			return len(appConnections.Items)
+		}, timeout, interval).Should(Equal(0))
+	})
+
+	It("should map Service types", func() {
+		serviceType, err := awiServiceType(corev1.ServiceTypeNodePort)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(serviceType).To(Equal("nodePort"))
+		_, err = awiServiceType(corev1.ServiceTypeClusterIP)
+		Expect(err).To(HaveOccurred())
+	})
+})
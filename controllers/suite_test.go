@@ -20,9 +20,12 @@ import (
 	"context"
 	"path/filepath"
 	"testing"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd/api"
@@ -31,9 +34,11 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/envtest"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
 
 	awiv1alpha1 "app-net-interface.io/kube-awi/api/awi/v1alpha1"
 	awiCl "app-net-interface.io/kube-awi/client"
+	"app-net-interface.io/kube-awi/pkg/sync"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -76,12 +81,19 @@ var _ = BeforeSuite(func() {
 	err = awiv1alpha1.AddToScheme(scheme.Scheme)
 	Expect(err).NotTo(HaveOccurred())
 
+	err = gatewayv1.AddToScheme(scheme.Scheme)
+	Expect(err).NotTo(HaveOccurred())
+
 	//+kubebuilder:scaffold:scheme
 
 	k8sClient, err = client.New(cfg, client.Options{Scheme: scheme.Scheme})
 	Expect(err).NotTo(HaveOccurred())
 	Expect(k8sClient).NotTo(BeNil())
 
+	// retained connections are recorded in the operator namespace
+	err = k8sClient.Create(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: sync.Namespace}})
+	Expect(err).NotTo(HaveOccurred())
+
 	k8sManager, err := ctrl.NewManager(cfg, ctrl.Options{
 		Scheme: scheme.Scheme,
 	})
@@ -93,6 +105,7 @@ var _ = BeforeSuite(func() {
 		Client:    k8sManager.GetClient(),
 		Scheme:    k8sManager.GetScheme(),
 		AwiClient: awiTestClient,
+		Recorder:  k8sManager.GetEventRecorderFor("internetworkdomainconnection-controller"),
 	}).SetupWithManager(k8sManager)
 	Expect(err).ToNot(HaveOccurred())
 
@@ -100,6 +113,28 @@ var _ = BeforeSuite(func() {
 		Client:    k8sManager.GetClient(),
 		Scheme:    k8sManager.GetScheme(),
 		AwiClient: awiTestClient,
+		Recorder:  k8sManager.GetEventRecorderFor("internetworkdomainappconnection-controller"),
+	}).SetupWithManager(k8sManager)
+	Expect(err).ToNot(HaveOccurred())
+
+	err = (&AccessPolicyReconciler{
+		Client:       k8sManager.GetClient(),
+		Scheme:       k8sManager.GetScheme(),
+		AwiClient:    awiTestClient,
+		PollInterval: time.Second,
+	}).SetupWithManager(k8sManager)
+	Expect(err).ToNot(HaveOccurred())
+
+	err = (&NetworkPolicyReconciler{
+		Client: k8sManager.GetClient(),
+		Scheme: k8sManager.GetScheme(),
+	}).SetupWithManager(k8sManager)
+	Expect(err).ToNot(HaveOccurred())
+
+	err = (&ServiceReconciler{
+		Client:      k8sManager.GetClient(),
+		Scheme:      k8sManager.GetScheme(),
+		ClusterName: "test-cluster",
 	}).SetupWithManager(k8sManager)
 	Expect(err).ToNot(HaveOccurred())
 
@@ -0,0 +1,63 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	awiv1alpha1 "app-net-interface.io/kube-awi/api/awi/v1alpha1"
+)
+
+type suspendable interface {
+	client.Object
+	IsSuspended() bool
+}
+
+// suspendToggled passes updates suspending or resuming reconciliation, so
+// the object is fully reconciled once it's resumed
+func suspendToggled(e event.UpdateEvent) bool {
+	oldObj, okOld := e.ObjectOld.(suspendable)
+	newObj, okNew := e.ObjectNew.(suspendable)
+	return okOld && okNew && oldObj.IsSuspended() != newObj.IsSuspended()
+}
+
+// setSuspendedCondition records whether reconciliation of the object is
+// suspended, it returns true if conditions were changed
+func setSuspendedCondition(conditions *[]metav1.Condition, suspended bool, generation int64) bool {
+	if suspended {
+		return meta.SetStatusCondition(conditions, metav1.Condition{
+			Type:               awiv1alpha1.ConditionSuspended,
+			Status:             metav1.ConditionTrue,
+			Reason:             "Suspended",
+			Message:            "No AWI calls are made until the object is resumed",
+			ObservedGeneration: generation,
+		})
+	}
+	if meta.FindStatusCondition(*conditions, awiv1alpha1.ConditionSuspended) == nil {
+		return false
+	}
+	return meta.SetStatusCondition(conditions, metav1.Condition{
+		Type:               awiv1alpha1.ConditionSuspended,
+		Status:             metav1.ConditionFalse,
+		Reason:             "Resumed",
+		Message:            "Reconciliation was resumed",
+		ObservedGeneration: generation,
+	})
+}
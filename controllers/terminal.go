@@ -0,0 +1,103 @@
+/*
+Copyright 2022.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"google.golang.org/grpc/status"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	awiv1alpha1 "app-net-interface.io/kube-awi/api/awi/v1alpha1"
+	awiClient "app-net-interface.io/kube-awi/client"
+	awipb "github.com/app-net-interface/awi-grpc/pb"
+)
+
+// awiErrorResult returns the result of reconciliation which failed on the
+// AWI call. Retryable errors are returned as they are, so the object is
+// requeued with backoff. Terminal ones are recorded in status with the
+// TerminalError condition and the object isn't requeued until its spec
+// changes.
+func awiErrorResult(ctx context.Context, k8sClient client.Client, obj client.Object,
+	conditions *[]metav1.Condition, state *string, err error) (ctrl.Result, error) {
+	if !awiClient.IsTerminal(err) {
+		return ctrl.Result{}, err
+	}
+	meta.SetStatusCondition(conditions, metav1.Condition{
+		Type:               awiv1alpha1.ConditionTerminalError,
+		Status:             metav1.ConditionTrue,
+		Reason:             status.Code(err).String(),
+		Message:            err.Error(),
+		ObservedGeneration: obj.GetGeneration(),
+	})
+	*state = awipb.Status_name[int32(awipb.Status_FAILED)]
+	if statusErr := k8sClient.Status().Update(ctx, obj); statusErr != nil {
+		return ctrl.Result{}, statusErr
+	}
+	return ctrl.Result{}, reconcile.TerminalError(err)
+}
+
+// deletionErrorResult returns the result of deletion which failed on the
+// AWI call. Even errors AWI reports as terminal are retried with backoff,
+// since the finalizer would be left on the object for good otherwise. They
+// are recorded with the DisconnectFailed condition, the deletion-policy
+// annotation set to Retain lets the object go.
+func deletionErrorResult(ctx context.Context, k8sClient client.Client, obj client.Object,
+	conditions *[]metav1.Condition, err error) (ctrl.Result, error) {
+	if !awiClient.IsTerminal(err) {
+		return ctrl.Result{}, err
+	}
+	changed := meta.SetStatusCondition(conditions, metav1.Condition{
+		Type:               awiv1alpha1.ConditionDisconnectFailed,
+		Status:             metav1.ConditionTrue,
+		Reason:             status.Code(err).String(),
+		Message:            err.Error(),
+		ObservedGeneration: obj.GetGeneration(),
+	})
+	if changed {
+		if statusErr := k8sClient.Status().Update(ctx, obj); statusErr != nil {
+			return ctrl.Result{}, statusErr
+		}
+	}
+	return ctrl.Result{}, err
+}
+
+// clearTerminalError removes the TerminalError condition once AWI accepted
+// the object, it returns true if conditions were changed
+func clearTerminalError(conditions *[]metav1.Condition) bool {
+	return meta.RemoveStatusCondition(conditions, awiv1alpha1.ConditionTerminalError)
+}
+
+// changedAfterTerminalError passes spec changes of objects rejected by AWI,
+// so they're retried even though updates aren't supported otherwise
+func changedAfterTerminalError(e event.UpdateEvent) bool {
+	if e.ObjectOld.GetGeneration() == e.ObjectNew.GetGeneration() {
+		return false
+	}
+	switch obj := e.ObjectOld.(type) {
+	case *awiv1alpha1.InterNetworkDomainConnection:
+		return meta.IsStatusConditionTrue(obj.Status.Conditions, awiv1alpha1.ConditionTerminalError)
+	case *awiv1alpha1.InterNetworkDomainAppConnection:
+		return meta.IsStatusConditionTrue(obj.Status.Conditions, awiv1alpha1.ConditionTerminalError)
+	}
+	return false
+}
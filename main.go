@@ -18,26 +18,37 @@
 package main
 
 import (
+	"context"
 	"flag"
+	"fmt"
+	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"app-net-interface.io/kube-awi/pkg/connection_status"
 	"app-net-interface.io/kube-awi/pkg/sync"
+	"app-net-interface.io/kube-awi/pkg/tracing"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
 	"go.uber.org/zap/zapcore"
+	"golang.org/x/oauth2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	gatewayv1 "sigs.k8s.io/gateway-api/apis/v1"
 
 	awiv1alpha1 "app-net-interface.io/kube-awi/api/awi/v1alpha1"
 	"app-net-interface.io/kube-awi/client"
@@ -48,15 +59,13 @@ import (
 var (
 	scheme   = runtime.NewScheme()
 	setupLog = ctrl.Log.WithName("setup")
-
-	// TODO make configurable
-	statusWatchInterval = 15 * time.Second
 )
 
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 
 	utilruntime.Must(awiv1alpha1.AddToScheme(scheme))
+	utilruntime.Must(gatewayv1.AddToScheme(scheme))
 	//+kubebuilder:scaffold:scheme
 }
 
@@ -65,9 +74,86 @@ func main() {
 	var enableLeaderElection bool
 	var awiCatalystAddress string
 	var probeAddr string
+	var enableNetworkPolicyTranslation bool
+	var endpointsDebounce time.Duration
+	var importConnections bool
+	var importDeletionPolicy string
+	var collectOrphans bool
+	var orphanGracePeriod time.Duration
+	var driftCheckInterval time.Duration
+	var awiCallTimeout time.Duration
+	var awiHealthCheckInterval time.Duration
+	var awiMaxMessageSize int
+	var syncInterval time.Duration
+	var syncTimeout time.Duration
+	var syncWorkers int
+	var discoveryFiltersPath string
+	var statusPollInterval time.Duration
+	var tracingOpts tracing.Options
+	var awiTokenFile string
+	var oidcTokenURL string
+	var oidcClientID string
+	var oidcClientSecretFile string
+	var oidcScopes string
+	var awiTLS bool
+	var awiTLSCAFile string
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
-	flag.StringVar(&awiCatalystAddress, "awi-catalyst-address", "localhost:50051", "The address of the AWI GRPC Catalyst SDWAN Controller.")
+	flag.StringVar(&awiCatalystAddress, "awi-catalyst-address", "localhost:50051",
+		"Comma-separated addresses of the AWI GRPC Catalyst SDWAN Controller, calls are sent to the first healthy one. "+
+			"Addresses prefixed with dns:/// are resolved to all their backends.")
+	flag.IntVar(&awiMaxMessageSize, "awi-max-message-size", client.DefaultMaxMessageSize,
+		"Maximal size in bytes of a response from the AWI GRPC server, e.g. a list of all instances.")
+	flag.DurationVar(&awiHealthCheckInterval, "awi-health-check-interval", client.DefaultHealthCheckInterval,
+		"How often health of AWI GRPC server addresses is checked.")
+	flag.DurationVar(&awiCallTimeout, "awi-call-timeout", client.DefaultCallTimeout,
+		"Deadline of a single call to the AWI GRPC server.")
+	flag.BoolVar(&awiTLS, "awi-tls", false,
+		"Connect to the AWI GRPC server with TLS, it's required for sending tokens.")
+	flag.StringVar(&awiTLSCAFile, "awi-tls-ca-file", "",
+		"PEM file with CA certificates the AWI GRPC server is verified with, system roots are used if it's empty. "+
+			"Setting it enables TLS.")
+	flag.StringVar(&awiTokenFile, "awi-token-file", "",
+		"File with the bearer token sent to the AWI GRPC server, e.g. a mounted Secret or a projected ServiceAccount token.")
+	flag.StringVar(&oidcTokenURL, "awi-oidc-token-url", "",
+		"Token endpoint of the OIDC provider issuing AWI tokens with the client credentials flow.")
+	flag.StringVar(&oidcClientID, "awi-oidc-client-id", "", "OIDC client ID used to get AWI tokens.")
+	flag.StringVar(&oidcClientSecretFile, "awi-oidc-client-secret-file", "",
+		"File with the OIDC client secret used to get AWI tokens.")
+	flag.StringVar(&oidcScopes, "awi-oidc-scopes", "", "Comma-separated scopes requested for AWI tokens.")
+	flag.BoolVar(&enableNetworkPolicyTranslation, "enable-network-policy-translation", false,
+		"Translate egress rules of NetworkPolicies labelled with "+controllers.NetworkPolicyEnabledLabel+
+			" into InterNetworkDomainAppConnections.")
+	flag.DurationVar(&endpointsDebounce, "endpoints-update-debounce", controllers.DefaultEndpointsDebounce,
+		"Minimal time between updates of pod IPs resolved for a single InterNetworkDomainAppConnection.")
+	flag.DurationVar(&syncInterval, "sync-interval", sync.DefaultSyncInterval,
+		"How often VPCs, subnets, instances, sites and VPNs are synced from AWI.")
+	flag.DurationVar(&syncTimeout, "sync-timeout", sync.DefaultSyncTimeout,
+		"How long a single sync of all objects from AWI may take.")
+	flag.IntVar(&syncWorkers, "sync-workers", sync.DefaultSyncWorkers,
+		"How many AWI calls, listing a kind of objects or a single cloud of a kind, are made by a sync at the same time.")
+	flag.StringVar(&discoveryFiltersPath, "discovery-filters", "",
+		"YAML file with filters selecting which discovered VPCs, subnets and instances are synced.")
+	flag.DurationVar(&statusPollInterval, "status-poll-interval", connection_status.DefaultPollInterval,
+		"How often states of connections, app connections and access policies in progress are polled from AWI.")
+	flag.BoolVar(&importConnections, "import-connections", false,
+		"Adopt connections and app connections created in AWI outside of Kubernetes "+
+			"by creating objects for them in the "+sync.Namespace+" namespace.")
+	flag.StringVar(&importDeletionPolicy, "import-deletion-policy", awiv1alpha1.DeletionPolicyRetain,
+		"Deletion policy of adopted objects, with "+awiv1alpha1.DeletionPolicyRetain+
+			" removing them leaves connections in AWI.")
+	flag.BoolVar(&collectOrphans, "garbage-collect-orphans", false,
+		"Remove connections created in AWI by the operator whose objects no longer exist.")
+	flag.DurationVar(&orphanGracePeriod, "orphan-grace-period", connection_status.DefaultOrphanGracePeriod,
+		"How long orphaned connections are reported before they're removed from AWI.")
+	flag.DurationVar(&driftCheckInterval, "drift-check-interval", controllers.DefaultDriftCheckInterval,
+		"How often the state of connections recorded by the status watcher is checked, connections which went missing or failed are re-issued, 0 disables the checks.")
+	flag.StringVar(&tracingOpts.Endpoint, "otlp-endpoint", "",
+		"Address of the OTLP gRPC collector traces are exported to, tracing is disabled if it's empty.")
+	flag.BoolVar(&tracingOpts.Insecure, "otlp-insecure", false,
+		"Connect to the OTLP collector without TLS.")
+	flag.Float64Var(&tracingOpts.SampleRatio, "trace-sample-ratio", 1.0,
+		"Fraction of traces started by the operator which are sampled.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
@@ -80,9 +166,54 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+	if importDeletionPolicy != awiv1alpha1.DeletionPolicyDelete && importDeletionPolicy != awiv1alpha1.DeletionPolicyRetain {
+		setupLog.Error(nil, "invalid import deletion policy", "policy", importDeletionPolicy)
+		os.Exit(1)
+	}
+
+	signalHandler := ctrl.SetupSignalHandler()
+	shutdownTracing, err := tracing.Setup(signalHandler, tracingOpts)
+	if err != nil {
+		setupLog.Error(err, "unable to set up tracing")
+		os.Exit(1)
+	}
+	tokenSource, err := awiTokenSource(signalHandler, awiTokenFile, oidcTokenURL, oidcClientID,
+		oidcClientSecretFile, oidcScopes)
+	if err != nil {
+		setupLog.Error(err, "unable to set up AWI credentials")
+		os.Exit(1)
+	}
+	var transportCreds credentials.TransportCredentials
+	if awiTLS || awiTLSCAFile != "" {
+		transportCreds, err = client.TransportCredentials(awiTLSCAFile)
+		if err != nil {
+			setupLog.Error(err, "unable to set up AWI TLS")
+			os.Exit(1)
+		}
+	} else if tokenSource != nil {
+		setupLog.Error(nil, "AWI tokens can't be sent without TLS, set --awi-tls")
+		os.Exit(1)
+	}
+	awiClient := client.NewClient(signalHandler, strings.Split(awiCatalystAddress, ","), awiCallTimeout,
+		awiHealthCheckInterval, transportCreds, &client.Credentials{
+			TokenSource: tokenSource,
+			ClusterName: os.Getenv("CLUSTER_NAME"),
+		}, grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(awiMaxMessageSize)))
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
-		Scheme:  scheme,
-		Metrics: metricsserver.Options{BindAddress: metricsAddr},
+		Scheme: scheme,
+		Metrics: metricsserver.Options{
+			BindAddress: metricsAddr,
+			ExtraHandlers: map[string]http.Handler{
+				"/awi/endpoints": awiClient.EndpointsHandler(),
+			},
+		},
+		Client: ctrlclient.Options{
+			Cache: &ctrlclient.CacheOptions{
+				// only the registry of retained connections is read, it's not worth a cluster-wide informer
+				DisableFor: []ctrlclient.Object{&corev1.ConfigMap{}},
+			},
+		},
 		WebhookServer: webhook.NewServer(webhook.Options{
 			Port: 9443,
 		}),
@@ -95,43 +226,153 @@ func main() {
 		os.Exit(1)
 	}
 
-	awiClient := client.NewClient(awiCatalystAddress)
-
 	if err = (&controllers.InterNetworkDomainConnectionReconciler{
-		Client:    mgr.GetClient(),
-		Scheme:    mgr.GetScheme(),
-		AwiClient: awiClient,
+		Client:             mgr.GetClient(),
+		Scheme:             mgr.GetScheme(),
+		AwiClient:          awiClient,
+		ClusterName:        os.Getenv("CLUSTER_NAME"),
+		Recorder:           mgr.GetEventRecorderFor("internetworkdomainconnection-controller"),
+		DriftCheckInterval: driftCheckInterval,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "InterNetworkDomainConnection")
 		os.Exit(1)
 	}
 	if err = (&controllers.AppConnectionReconciler{
+		Client:             mgr.GetClient(),
+		Scheme:             mgr.GetScheme(),
+		AwiClient:          awiClient,
+		ClusterName:        os.Getenv("CLUSTER_NAME"),
+		Recorder:           mgr.GetEventRecorderFor("internetworkdomainappconnection-controller"),
+		EndpointsDebounce:  endpointsDebounce,
+		DriftCheckInterval: driftCheckInterval,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "InterNetworkDomainAppConnection")
+		os.Exit(1)
+	}
+	if err = (&controllers.AccessPolicyReconciler{
+		Client:       mgr.GetClient(),
+		Scheme:       mgr.GetScheme(),
+		AwiClient:    awiClient,
+		PollInterval: statusPollInterval,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "AccessPolicy")
+		os.Exit(1)
+	}
+	if err = (&controllers.ServiceReconciler{
 		Client:      mgr.GetClient(),
 		Scheme:      mgr.GetScheme(),
-		AwiClient:   awiClient,
 		ClusterName: os.Getenv("CLUSTER_NAME"),
 	}).SetupWithManager(mgr); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "InterNetworkDomainAppConnection")
+		setupLog.Error(err, "unable to create controller", "controller", "Service")
 		os.Exit(1)
 	}
+	if enableNetworkPolicyTranslation {
+		if err = (&controllers.NetworkPolicyReconciler{
+			Client: mgr.GetClient(),
+			Scheme: mgr.GetScheme(),
+		}).SetupWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "NetworkPolicy")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)
 	}
-	if err := mgr.AddReadyzCheck("readyz", healthz.Ping); err != nil {
-		setupLog.Error(err, "unable to set up ready check")
+	if err := sync.SetupIndexes(signalHandler, mgr.GetFieldIndexer()); err != nil {
+		setupLog.Error(err, "unable to set up field indexes")
+		os.Exit(1)
+	}
+	syncers := sync.NewSyncers(mgr.GetClient(), awiClient, syncWorkers).
+		WithInterval(syncInterval).
+		WithTimeout(syncTimeout).
+		WithCache(mgr.GetCache())
+	if discoveryFiltersPath != "" {
+		filters, err := sync.LoadDiscoveryFilters(discoveryFiltersPath)
+		if err != nil {
+			setupLog.Error(err, "unable to load discovery filters")
+			os.Exit(1)
+		}
+		syncers.WithFilters(filters)
+	}
+	if importConnections {
+		syncers.WithConnectionImport(mgr.GetClient(), awiClient, importDeletionPolicy)
+	}
+	if err := mgr.Add(syncers); err != nil {
+		setupLog.Error(err, "unable to set up syncers")
+		os.Exit(1)
+	}
+	if err := mgr.Add(&connection_status.StatusWatcher{
+		AwiClient: awiClient,
+		K8sClient: mgr.GetClient(),
+		Interval:  statusPollInterval,
+		Cache:     mgr.GetCache(),
+		Orphans: &connection_status.OrphanDetector{
+			ClusterName:    os.Getenv("CLUSTER_NAME"),
+			Recorder:       mgr.GetEventRecorderFor("awi-status-watcher"),
+			CollectGarbage: collectOrphans,
+			GracePeriod:    orphanGracePeriod,
+		},
+	}); err != nil {
+		setupLog.Error(err, "unable to set up status watcher")
 		os.Exit(1)
 	}
+	// each check is served on its own /readyz/<name> sub-path as well
+	readyChecks := map[string]healthz.Checker{
+		"awi-connectivity": awiClient.ConnectivityCheck,
+		"inventory-sync":   leaderOnly(mgr.Elected(), syncers.SyncedCheck),
+		"status-poll":      leaderOnly(mgr.Elected(), connection_status.PolledCheck),
+	}
+	for name, check := range readyChecks {
+		if err := mgr.AddReadyzCheck(name, check); err != nil {
+			setupLog.Error(err, "unable to set up ready check", "check", name)
+			os.Exit(1)
+		}
+	}
 
 	setupLog.Info("starting manager")
-	signalHandler := ctrl.SetupSignalHandler()
-	go sync.NewSyncers(mgr.GetClient(), awiClient).StartPeriodicSync(signalHandler)
-	go connection_status.WatchStatusUpdates(signalHandler,
-		awiClient, mgr.GetClient(), statusWatchInterval)
 	if err := mgr.Start(signalHandler); err != nil {
 		setupLog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
+	// the signal handler's context is done by now, pending spans get a fresh one
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := shutdownTracing(ctx); err != nil {
+		setupLog.Error(err, "failed to flush traces")
+	}
+}
+
+// awiTokenSource returns the source of tokens sent to AWI, it's nil if
+// neither a token file nor an OIDC provider is configured
+func awiTokenSource(ctx context.Context, tokenFile, oidcTokenURL, oidcClientID, oidcClientSecretFile,
+	oidcScopes string) (oauth2.TokenSource, error) {
+	switch {
+	case tokenFile != "" && oidcTokenURL != "":
+		return nil, fmt.Errorf("token file and OIDC provider can't be used together")
+	case tokenFile != "":
+		return client.FileTokenSource(tokenFile), nil
+	case oidcTokenURL != "":
+		var scopes []string
+		if oidcScopes != "" {
+			scopes = strings.Split(oidcScopes, ",")
+		}
+		return client.ClientCredentialsTokenSource(ctx, oidcTokenURL, oidcClientID, oidcClientSecretFile, scopes)
+	}
+	return nil, nil
+}
+
+// leaderOnly passes the check on standby replicas, which neither sync
+// nor poll, so they stay ready and rollouts aren't blocked
+func leaderOnly(elected <-chan struct{}, check healthz.Checker) healthz.Checker {
+	return func(req *http.Request) error {
+		select {
+		case <-elected:
+			return check(req)
+		default:
+			return nil
+		}
+	}
 }
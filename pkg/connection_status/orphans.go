@@ -0,0 +1,239 @@
+// Copyright (c) 2023 Cisco Systems, Inc. and its affiliates
+// All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http:www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+package connection_status
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	k8sclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	apiv1 "app-net-interface.io/kube-awi/api/awi/v1alpha1"
+	awiClient "app-net-interface.io/kube-awi/client"
+	awi "github.com/app-net-interface/awi-grpc/pb"
+)
+
+//+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+
+// DefaultOrphanGracePeriod is how long an orphaned connection is reported
+// before it's garbage collected
+const DefaultOrphanGracePeriod = 10 * time.Minute
+
+var orphanedConnections = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "awi_orphaned_connections",
+	Help: "Number of connections created in AWI by the operator whose objects no longer exist",
+}, []string{"kind"})
+
+func init() {
+	metrics.Registry.MustRegister(orphanedConnections)
+}
+
+// OrphanDetector finds connections created in AWI by the operator running
+// in this cluster, whose objects are gone, e.g. because the finalizer was
+// removed by hand. Orphans are reported with metrics and events, and
+// optionally disconnected after the grace period.
+type OrphanDetector struct {
+	ClusterName string
+	Recorder    record.EventRecorder
+	// CollectGarbage enables disconnecting orphans reported for longer than GracePeriod
+	CollectGarbage bool
+	GracePeriod    time.Duration
+
+	firstSeen      map[string]time.Time
+	disabledLogged bool
+	// listed holds IDs of connections listed in AWI in the last pass, by kind
+	listed map[string]map[string]struct{}
+	// unlisted holds UIDs of retained connections missing in the last pass
+	unlisted map[string]struct{}
+}
+
+// orphanCandidate is a connection or app connection from AWI
+type orphanCandidate struct {
+	id         string
+	labels     map[string]string
+	disconnect func() error
+}
+
+func (d *OrphanDetector) checkConnections(ctx context.Context, awiClient *awiClient.AwiGrpcClient,
+	logger logr.Logger, k8sClient k8sclient.Client,
+	connections []*awi.ConnectionInformation, crds []apiv1.InterNetworkDomainConnection) {
+	if d == nil {
+		return
+	}
+	candidates := make([]orphanCandidate, 0, len(connections))
+	for _, conn := range connections {
+		conn := conn
+		candidates = append(candidates, orphanCandidate{
+			id:     conn.GetId(),
+			labels: conn.GetMetadata().GetLabels(),
+			disconnect: func() error {
+				return awiClient.DisconnectRequest(ctx, &awi.ConnectionRequest{
+					Metadata: conn.GetMetadata(),
+					Spec:     conn.GetConfig(),
+				}, conn.GetId())
+			},
+		})
+	}
+	owners := make(map[types.UID]struct{}, len(crds))
+	for i := range crds {
+		owners[crds[i].GetUID()] = struct{}{}
+	}
+	d.check(ctx, logger, k8sClient, "InterNetworkDomainConnection", candidates, owners)
+}
+
+func (d *OrphanDetector) checkAppConnections(ctx context.Context, awiClient *awiClient.AwiGrpcClient,
+	logger logr.Logger, k8sClient k8sclient.Client,
+	appConnections []*awi.AppConnectionInformation, crds []apiv1.InterNetworkDomainAppConnection) {
+	if d == nil {
+		return
+	}
+	candidates := make([]orphanCandidate, 0, len(appConnections))
+	for _, appConn := range appConnections {
+		appConn := appConn
+		candidates = append(candidates, orphanCandidate{
+			id:     appConn.GetId(),
+			labels: appConn.GetAppConnectionConfig().GetMetadata().GetLabel(),
+			disconnect: func() error {
+				return awiClient.AppDisconnectRequest(ctx, appConn.GetAppConnectionConfig(), appConn.GetId())
+			},
+		})
+	}
+	owners := make(map[types.UID]struct{}, len(crds))
+	for i := range crds {
+		owners[crds[i].GetUID()] = struct{}{}
+	}
+	d.check(ctx, logger, k8sClient, "InterNetworkDomainAppConnection", candidates, owners)
+}
+
+func (d *OrphanDetector) check(ctx context.Context, logger logr.Logger, k8sClient k8sclient.Client,
+	kind string, candidates []orphanCandidate, owners map[types.UID]struct{}) {
+	if d.listed == nil {
+		d.listed = map[string]map[string]struct{}{}
+	}
+	listed := make(map[string]struct{}, len(candidates))
+	for _, candidate := range candidates {
+		listed[candidate.id] = struct{}{}
+	}
+	d.listed[kind] = listed
+
+	if d.ClusterName == "" {
+		// every operator deployed without a cluster name would take
+		// connections of the others for its own
+		if !d.disabledLogged {
+			logger.Info("CLUSTER_NAME isn't set, orphaned connections aren't detected")
+			d.disabledLogged = true
+		}
+		return
+	}
+	if d.firstSeen == nil {
+		d.firstSeen = map[string]time.Time{}
+	}
+	retained, err := retainedOwners(ctx, k8sClient)
+	if err != nil {
+		logger.Error(err, "failed to get retained connections")
+		return
+	}
+
+	orphans := 0
+	stillOrphaned := map[string]struct{}{}
+	for _, candidate := range candidates {
+		uid, ok := candidate.labels[awiClient.OwnerUIDLabel]
+		if !ok || candidate.labels[awiClient.OwnerClusterLabel] != d.ClusterName {
+			// not created by the operator running in this cluster
+			continue
+		}
+		if _, ok := owners[types.UID(uid)]; ok {
+			continue
+		}
+		if _, ok := retained[uid]; ok {
+			continue
+		}
+		orphans++
+		key := kind + "/" + candidate.id
+		stillOrphaned[key] = struct{}{}
+		owner := &corev1.ObjectReference{
+			APIVersion: apiv1.GroupVersion.String(),
+			Kind:       kind,
+			Namespace:  candidate.labels[awiClient.OwnerNamespaceLabel],
+			Name:       candidate.labels[awiClient.OwnerNameLabel],
+			UID:        types.UID(uid),
+		}
+		firstSeen, ok := d.firstSeen[key]
+		if !ok {
+			firstSeen = time.Now()
+			d.firstSeen[key] = firstSeen
+			logger.Info("Found orphaned connection", "kind", kind, "id", candidate.id,
+				"namespace", owner.Namespace, "name", owner.Name)
+			d.Recorder.Eventf(owner, corev1.EventTypeWarning, "Orphaned",
+				"Connection %s exists in AWI, but its %s was removed", candidate.id, kind)
+		}
+		if !d.CollectGarbage || time.Since(firstSeen) < d.GracePeriod {
+			continue
+		}
+		logger.Info("Removing orphaned connection", "kind", kind, "id", candidate.id)
+		if err := candidate.disconnect(); err != nil {
+			logger.Error(err, "failed to remove orphaned connection", "kind", kind, "id", candidate.id)
+			continue
+		}
+		d.Recorder.Eventf(owner, corev1.EventTypeNormal, "OrphanRemoved",
+			"Orphaned connection %s was removed from AWI", candidate.id)
+	}
+	for key := range d.firstSeen {
+		if _, ok := stillOrphaned[key]; !ok && strings.HasPrefix(key, kind+"/") {
+			delete(d.firstSeen, key)
+		}
+	}
+	orphanedConnections.WithLabelValues(kind).Set(float64(orphans))
+}
+
+// pruneRetained drops retained connections which weren't listed in AWI in
+// two passes in a row, they were removed and can't become orphans. One
+// pass isn't enough, the list could be taken before the connection was
+// retained. It's run once both kinds were listed.
+func (d *OrphanDetector) pruneRetained(ctx context.Context, logger logr.Logger, k8sClient k8sclient.Client) {
+	if d == nil {
+		return
+	}
+	if d.unlisted == nil {
+		d.unlisted = map[string]struct{}{}
+	}
+	err := forgetRetainedConnections(ctx, k8sClient, func(uid, connectionId string) bool {
+		for _, listed := range d.listed {
+			if _, ok := listed[connectionId]; ok {
+				delete(d.unlisted, uid)
+				return false
+			}
+		}
+		if _, ok := d.unlisted[uid]; ok {
+			delete(d.unlisted, uid)
+			logger.Info("Forgetting retained connection removed from AWI", "uid", uid, "id", connectionId)
+			return true
+		}
+		d.unlisted[uid] = struct{}{}
+		return false
+	})
+	if err != nil {
+		logger.Error(err, "failed to prune retained connections")
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright (c) 2023 Cisco Systems, Inc. and its affiliates
+// All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http:www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+package connection_status
+
+import (
+	"context"
+	"time"
+
+	awiv1alpha1 "app-net-interface.io/kube-awi/api/awi/v1alpha1"
+	"app-net-interface.io/kube-awi/client"
+	awi "github.com/app-net-interface/awi-grpc/pb"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/stretchr/testify/mock"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	k8sclient "sigs.k8s.io/controller-runtime/pkg/client"
+
+	"app-net-interface.io/kube-awi/pkg/sync"
+	awiMock "github.com/app-net-interface/awi-grpc/mocks"
+)
+
+var _ = Describe("Orphan detector", func() {
+	It("should report and remove connections whose objects were deleted", func() {
+		ctx := context.Background()
+		By("By creating a connection which still exists")
+		connSvc := &awiv1alpha1.InterNetworkDomainConnection{
+			ObjectMeta: metav1.ObjectMeta{Name: "orphan-owner", Namespace: namespace},
+			Spec: awiv1alpha1.InterNetworkDomainConnectionSpec{
+				ConnectionRequest: awi.ConnectionRequest{
+					Metadata: &awi.ConnectionMetadata{Name: "orphan-owner"},
+				},
+			},
+		}
+		Expect(k8sClient.Create(ctx, connSvc)).Should(Succeed())
+
+		ownerLabels := func(uid string) map[string]string {
+			return map[string]string{
+				client.OwnerClusterLabel:   "test-cluster",
+				client.OwnerNamespaceLabel: namespace,
+				client.OwnerNameLabel:      "removed",
+				client.OwnerUIDLabel:       uid,
+			}
+		}
+		mockConnectionController := awiMock.NewConnectionControllerClient(GinkgoT())
+		mockConnectionController.On("ListConnections",
+			mock.Anything, mock.Anything).Return(&awi.ListConnectionsResponse{
+			Connections: []*awi.ConnectionInformation{
+				{
+					Id:       "owned",
+					Metadata: &awi.ConnectionMetadata{Labels: ownerLabels(string(connSvc.GetUID()))},
+				},
+				{
+					Id:       "orphaned",
+					Metadata: &awi.ConnectionMetadata{Labels: ownerLabels("removed-uid")},
+				},
+				{
+					// created outside of this cluster
+					Id: "foreign",
+				},
+			},
+		}, nil)
+		mockConnectionController.On("Disconnect", mock.Anything,
+			&awi.DisconnectRequest{ConnectionId: "orphaned"}).Return(&awi.DisconnectResponse{}, nil)
+		mockAppConnectionController := awiMock.NewAppConnectionControllerClient(GinkgoT())
+		mockAppConnectionController.On("ListConnectedApps",
+			mock.Anything, mock.Anything).Return(&awi.ListAppConnectionsResponse{}, nil)
+
+		awiClient := &client.AwiGrpcClient{
+			ConnectionControllerClient:    mockConnectionController,
+			AppConnectionControllerClient: mockAppConnectionController,
+		}
+		recorder := record.NewFakeRecorder(10)
+		orphans := &OrphanDetector{
+			ClusterName:    "test-cluster",
+			Recorder:       recorder,
+			CollectGarbage: true,
+		}
+		ctxWithCancel, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go WatchStatusUpdates(ctxWithCancel, awiClient, k8sClient, time.Millisecond*100, orphans)
+
+		Eventually(recorder.Events, timeout, interval).Should(Receive(ContainSubstring("Orphaned")))
+		Eventually(recorder.Events, timeout, interval).Should(Receive(ContainSubstring("OrphanRemoved")))
+	})
+
+	It("should forget retained connections removed from AWI", func() {
+		ctx := context.Background()
+		Expect(k8sClient.Create(ctx, &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{Name: sync.Namespace},
+		})).Should(Succeed())
+		Expect(k8sClient.Create(ctx, &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: RetainedConnectionsConfigMap, Namespace: sync.Namespace},
+			Data: map[string]string{
+				"kept-uid":    "kept",
+				"removed-uid": "removed",
+			},
+		})).Should(Succeed())
+
+		mockConnectionController := awiMock.NewConnectionControllerClient(GinkgoT())
+		mockConnectionController.On("ListConnections",
+			mock.Anything, mock.Anything).Return(&awi.ListConnectionsResponse{
+			Connections: []*awi.ConnectionInformation{{Id: "kept"}},
+		}, nil)
+		mockAppConnectionController := awiMock.NewAppConnectionControllerClient(GinkgoT())
+		mockAppConnectionController.On("ListConnectedApps",
+			mock.Anything, mock.Anything).Return(&awi.ListAppConnectionsResponse{}, nil)
+
+		awiClient := &client.AwiGrpcClient{
+			ConnectionControllerClient:    mockConnectionController,
+			AppConnectionControllerClient: mockAppConnectionController,
+		}
+		orphans := &OrphanDetector{
+			ClusterName: "test-cluster",
+			Recorder:    record.NewFakeRecorder(10),
+		}
+		ctxWithCancel, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go WatchStatusUpdates(ctxWithCancel, awiClient, k8sClient, time.Millisecond*100, orphans)
+
+		Eventually(func() map[string]string {
+			var configMap corev1.ConfigMap
+			key := k8sclient.ObjectKey{Name: RetainedConnectionsConfigMap, Namespace: sync.Namespace}
+			if err := k8sClient.Get(ctx, key, &configMap); err != nil {
+				return nil
+			}
+			return configMap.Data
+		}, timeout, interval).Should(Equal(map[string]string{"kept-uid": "kept"}))
+	})
+})
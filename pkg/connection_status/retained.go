@@ -0,0 +1,92 @@
+// Copyright (c) 2023 Cisco Systems, Inc. and its affiliates
+// All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http:www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+package connection_status
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	"app-net-interface.io/kube-awi/pkg/sync"
+)
+
+//+kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;create;update;patch
+
+// RetainedConnectionsConfigMap keeps connections left in AWI when their
+// objects were deleted with Retain deletion policy. It maps UID of the
+// removed object to the connection ID, entries are dropped once the
+// connection is gone from AWI, so it doesn't outgrow the ConfigMap limit.
+const RetainedConnectionsConfigMap = "awi-retained-connections"
+
+// RecordRetainedConnection remembers that connection of the object was
+// intentionally left in AWI, so it's not reported as orphaned.
+func RecordRetainedConnection(ctx context.Context, k8sClient k8sclient.Client,
+	obj k8sclient.Object, connectionId string) error {
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: RetainedConnectionsConfigMap, Namespace: sync.Namespace},
+	}
+	_, err := controllerutil.CreateOrUpdate(ctx, k8sClient, configMap, func() error {
+		if configMap.Data == nil {
+			configMap.Data = map[string]string{}
+		}
+		configMap.Data[string(obj.GetUID())] = connectionId
+		return nil
+	})
+	return err
+}
+
+// retainedOwners returns UIDs of removed objects whose connections were retained
+func retainedOwners(ctx context.Context, k8sClient k8sclient.Client) (map[string]string, error) {
+	var configMap corev1.ConfigMap
+	err := k8sClient.Get(ctx, k8sclient.ObjectKey{Name: RetainedConnectionsConfigMap, Namespace: sync.Namespace}, &configMap)
+	if apierrors.IsNotFound(err) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return configMap.Data, nil
+}
+
+// forgetRetainedConnections removes entries of retained connections for
+// which expired returns true
+func forgetRetainedConnections(ctx context.Context, k8sClient k8sclient.Client,
+	expired func(uid, connectionId string) bool) error {
+	var configMap corev1.ConfigMap
+	err := k8sClient.Get(ctx, k8sclient.ObjectKey{Name: RetainedConnectionsConfigMap, Namespace: sync.Namespace}, &configMap)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	changed := false
+	for uid, connectionId := range configMap.Data {
+		if expired(uid, connectionId) {
+			delete(configMap.Data, uid)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return k8sClient.Update(ctx, &configMap)
+}
@@ -19,6 +19,9 @@ package connection_status
 
 import (
 	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-logr/logr"
@@ -26,57 +29,150 @@ import (
 
 	apiv1 "app-net-interface.io/kube-awi/api/awi/v1alpha1"
 	awiClient "app-net-interface.io/kube-awi/client"
+	"app-net-interface.io/kube-awi/pkg/sync"
+	"app-net-interface.io/kube-awi/pkg/tracing"
 	awi "github.com/app-net-interface/awi-grpc/pb"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	k8sclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
 )
 
+// DefaultPollInterval is how often states of connections are polled, AWI
+// has no way to stream their changes
+const DefaultPollInterval = 15 * time.Second
+
+// polled is set once a pass of the watcher listed both kinds successfully
+var polled atomic.Bool
+
+// StatusWatcher runs WatchStatusUpdates as a runnable of the manager, only
+// on the leader, so replicas don't race on status updates
+type StatusWatcher struct {
+	AwiClient *awiClient.AwiGrpcClient
+	K8sClient k8sclient.Client
+	Interval  time.Duration
+	Orphans   *OrphanDetector
+	// Cache backs K8sClient, the watcher waits until it has synced
+	// connections before the first pass
+	Cache cache.Cache
+}
+
+var _ manager.LeaderElectionRunnable = &StatusWatcher{}
+var _ manager.Runnable = &StatusWatcher{}
+
+func (w *StatusWatcher) Start(ctx context.Context) error {
+	if w.Cache != nil {
+		err := sync.WaitForInformers(ctx, w.Cache,
+			&apiv1.InterNetworkDomainConnection{}, &apiv1.InterNetworkDomainAppConnection{})
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+	}
+	WatchStatusUpdates(ctx, w.AwiClient, w.K8sClient, w.Interval, w.Orphans)
+	return nil
+}
+
+func (w *StatusWatcher) NeedLeaderElection() bool {
+	return true
+}
+
 func WatchStatusUpdates(ctx context.Context,
 	awiClient *awiClient.AwiGrpcClient,
 	k8sClient k8sclient.Client,
-	interval time.Duration) {
+	interval time.Duration,
+	orphans *OrphanDetector) {
 	logger := ctrl.Log.WithName("status-update-watcher")
-	checkConnectionsStatuses(awiClient, logger, k8sClient)
-	checkAppConnectionsStatuses(awiClient, logger, k8sClient)
-	// TODO make configurable
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	checkStatuses(ctx, awiClient, logger, k8sClient, orphans)
 	ticker := time.NewTicker(interval)
 	for {
 		select {
 		case t := <-ticker.C:
 			logger.Info("Periodic status check", "time", t)
-			checkConnectionsStatuses(awiClient, logger, k8sClient)
-			checkAppConnectionsStatuses(awiClient, logger, k8sClient)
+			checkStatuses(ctx, awiClient, logger, k8sClient, orphans)
 		case <-ctx.Done():
 			return
 		}
 	}
 }
 
-func checkConnectionsStatuses(awiClient *awiClient.AwiGrpcClient, logger logr.Logger,
-	k8sClient k8sclient.Client) {
-	connections, err := awiClient.ListConnections()
-	if err != nil {
-		logger.Error(err, "failed to list connections in awi grpc server")
-		return
+// checkStatuses runs a single pass of the watcher, traced as one span
+func checkStatuses(ctx context.Context, awiClient *awiClient.AwiGrpcClient, logger logr.Logger,
+	k8sClient k8sclient.Client, orphans *OrphanDetector) {
+	ctx, span := tracing.Start(ctx, "WatchStatusUpdates.check")
+	defer span.End()
+	connectionsOk := checkConnectionsStatuses(ctx, awiClient, logger, k8sClient, orphans)
+	appConnectionsOk := checkAppConnectionsStatuses(ctx, awiClient, logger, k8sClient, orphans)
+	if connectionsOk && appConnectionsOk {
+		polled.Store(true)
+		orphans.pruneRetained(ctx, logger, k8sClient)
 	}
-	connectionsMap := make(map[string]*awi.ConnectionInformation, len(connections))
-	for _, conn := range connections {
-		connectionsMap[conn.GetId()] = conn
+}
+
+// PolledCheck is a readiness check passing once statuses of connections
+// and app connections were polled successfully at least once
+func PolledCheck(_ *http.Request) error {
+	if !polled.Load() {
+		return errors.New("statuses haven't been polled successfully yet")
 	}
+	return nil
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+// checkConnectionsStatuses updates statuses of InterNetworkDomainConnections,
+// it returns false if they or connections in AWI couldn't be listed
+func checkConnectionsStatuses(ctx context.Context, awiClient *awiClient.AwiGrpcClient, logger logr.Logger,
+	k8sClient k8sclient.Client, orphans *OrphanDetector) bool {
+	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
 	defer cancel()
 
+	// objects are listed before AWI, so a connection whose ID was stored
+	// meanwhile isn't taken for missing
 	var interNetworkDomainConnectionList apiv1.InterNetworkDomainConnectionList
-	err = k8sClient.List(ctx, &interNetworkDomainConnectionList)
+	err := k8sClient.List(ctx, &interNetworkDomainConnectionList)
 	if err != nil {
 		logger.Error(err, "failed to list InterNetworkDomainConnection CRDs")
-		return
+		return false
+	}
+	connections, err := awiClient.ListConnections(ctx)
+	if err != nil {
+		logger.Error(err, "failed to list connections in awi grpc server")
+		return false
+	}
+	connectionsMap := make(map[string]*awi.ConnectionInformation, len(connections))
+	for _, conn := range connections {
+		connectionsMap[conn.GetId()] = conn
+	}
+	if orphans != nil {
+		// owners are listed again after AWI, so a connection created
+		// meanwhile isn't taken for an orphan
+		var owners apiv1.InterNetworkDomainConnectionList
+		if err := k8sClient.List(ctx, &owners); err != nil {
+			logger.Error(err, "failed to list InterNetworkDomainConnection CRDs")
+			return false
+		}
+		orphans.checkConnections(ctx, awiClient, logger, k8sClient, connections, owners.Items)
 	}
 
 	for _, crd := range interNetworkDomainConnectionList.Items {
-		conn, ok := connectionsMap[awiClient.GetConnectionId(&crd.Spec)]
-		if !ok {
-			logger.Error(err, "couldn't find connection matching to CRD",
+		if crd.IsSuspended() {
+			continue
+		}
+		var conn *awi.ConnectionInformation
+		if crd.Status.ConnectionId == "" {
+			// objects created before IDs were stored are matched by spec
+			conn = findConnection(connections, &crd)
+		} else if conn = connectionsMap[crd.Status.ConnectionId]; conn == nil {
+			// the stored ID isn't rematched by spec, it could pick up a
+			// connection owned by another object
+			markMissing(ctx, logger, k8sClient, &crd, &crd.Status.State)
+			continue
+		}
+		if conn == nil {
+			logger.Info("couldn't find connection matching to CRD",
 				"namespace", crd.GetNamespace(), "name", crd.GetName())
 			continue
 		}
@@ -85,11 +181,11 @@ func checkConnectionsStatuses(awiClient *awiClient.AwiGrpcClient, logger logr.Lo
 			"CRD current status", crd.Status, "connection status", conn.GetStatus(),
 			"connection string status", awi.Status_name[int32(conn.GetStatus())])
 		if crd.Status.State == awi.Status_name[int32(conn.GetStatus())] &&
-			crd.Status.ConnectionId == awiClient.GetConnectionId(&crd.Spec) {
+			crd.Status.ConnectionId == conn.GetId() {
 			continue
 		}
 		crd.Status.State = awi.Status_name[int32(conn.GetStatus())]
-		crd.Status.ConnectionId = awiClient.GetConnectionId(&crd.Spec)
+		crd.Status.ConnectionId = conn.GetId()
 		err = k8sClient.Status().Update(ctx, &crd)
 		if err != nil {
 			logger.Error(err, "couldn't update InterNetworkDomainConnection CRD status",
@@ -98,48 +194,121 @@ func checkConnectionsStatuses(awiClient *awiClient.AwiGrpcClient, logger logr.Lo
 			continue
 		}
 	}
+	return true
 }
 
-func checkAppConnectionsStatuses(awiClient *awiClient.AwiGrpcClient, logger logr.Logger,
-	k8sClient k8sclient.Client) {
-	appConnections, err := awiClient.ListAppConnections()
-	if err != nil {
-		logger.Error(err, "failed to list appConnections in awi grpc server")
+// markMissing sets the state of the object to MISSING, the controllers
+// treat it as drift and request the connection again
+func markMissing(ctx context.Context, logger logr.Logger, k8sClient k8sclient.Client,
+	obj k8sclient.Object, state *string) {
+	if *state == apiv1.StateMissing {
 		return
 	}
+	logger.Info("connection stored in CRD status is missing in AWI",
+		"namespace", obj.GetNamespace(), "name", obj.GetName(), "state", *state)
+	*state = apiv1.StateMissing
+	if err := k8sClient.Status().Update(ctx, obj); err != nil {
+		logger.Error(err, "couldn't mark CRD as missing",
+			"namespace", obj.GetNamespace(), "name", obj.GetName())
+	}
+}
+
+func findConnection(connections []*awi.ConnectionInformation,
+	crd *apiv1.InterNetworkDomainConnection) *awi.ConnectionInformation {
+	for _, conn := range connections {
+		if awiClient.MatchesConnection(conn, &crd.Spec.ConnectionRequest) {
+			return conn
+		}
+	}
+	return nil
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+// checkAppConnectionsStatuses updates statuses of
+// InterNetworkDomainAppConnections, it returns false if they or app
+// connections in AWI couldn't be listed
+func checkAppConnectionsStatuses(ctx context.Context, awiClient *awiClient.AwiGrpcClient, logger logr.Logger,
+	k8sClient k8sclient.Client, orphans *OrphanDetector) bool {
+	ctx, cancel := context.WithTimeout(ctx, 60*time.Second)
 	defer cancel()
+
+	// objects are listed before AWI, so an app connection whose ID was
+	// stored meanwhile isn't taken for missing
 	var appConnectionList apiv1.InterNetworkDomainAppConnectionList
-	err = k8sClient.List(ctx, &appConnectionList)
+	err := k8sClient.List(ctx, &appConnectionList)
 	if err != nil {
 		logger.Error(err, "failed to list InterNetworkDomainAppConnection CRDs")
-		return
+		return false
+	}
+	appConnections, err := awiClient.ListAppConnections(ctx)
+	if err != nil {
+		logger.Error(err, "failed to list appConnections in awi grpc server")
+		return false
+	}
+	if orphans != nil {
+		// owners are listed again after AWI, so an app connection created
+		// meanwhile isn't taken for an orphan
+		var owners apiv1.InterNetworkDomainAppConnectionList
+		if err := k8sClient.List(ctx, &owners); err != nil {
+			logger.Error(err, "failed to list InterNetworkDomainAppConnection CRDs")
+			return false
+		}
+		orphans.checkAppConnections(ctx, awiClient, logger, k8sClient, appConnections, owners.Items)
+	}
+
+	appConnectionsMap := make(map[string]*awi.AppConnectionInformation, len(appConnections))
+	for _, appConn := range appConnections {
+		appConnectionsMap[appConn.GetId()] = appConn
 	}
 
 	for _, crd := range appConnectionList.Items {
-		for _, appConn := range appConnections {
-			// looking for appConnection matching to CRD
-			if !(crd.Spec.AppConnection.GetNetworkDomainConnection().GetSelector().GetMatchName() == appConn.GetAppConnectionConfig().GetNetworkDomainConnection().GetSelector().GetMatchName()) ||
-				!(crd.Spec.AppConnection.GetMetadata().GetName() == appConn.GetAppConnectionConfig().GetMetadata().GetName()) {
-				continue
-			}
-			logger.Info("Checking status of InterNetworkDomainAppConnection item",
+		if crd.IsSuspended() {
+			continue
+		}
+		var appConn *awi.AppConnectionInformation
+		if crd.Status.ConnectionId == "" {
+			// objects created before IDs were stored are matched by name
+			appConn = findAppConnection(appConnections, &crd)
+		} else if appConn = appConnectionsMap[crd.Status.ConnectionId]; appConn == nil {
+			markMissing(ctx, logger, k8sClient, &crd, &crd.Status.State)
+			continue
+		}
+		if appConn == nil {
+			continue
+		}
+		logger.Info("Checking status of InterNetworkDomainAppConnection item",
+			"namespace", crd.GetNamespace(), "name", crd.GetName(),
+			"CRD current status", crd.Status, "connection status", appConn.GetStatus(),
+			"connection string status", awi.Status_name[int32(appConn.GetStatus())])
+		if crd.Status.State == awi.Status_name[int32(appConn.GetStatus())] &&
+			crd.Status.ConnectionId == appConn.GetId() {
+			continue
+		}
+		crd.Status.State = awi.Status_name[int32(appConn.GetStatus())]
+		crd.Status.ConnectionId = appConn.GetId()
+		err = k8sClient.Status().Update(ctx, &crd)
+		if err != nil {
+			logger.Error(err, "couldn't update InterNetworkDomainAppConnection CRD status",
 				"namespace", crd.GetNamespace(), "name", crd.GetName(),
-				"CRD current status", crd.Status, "connection status", appConn.GetStatus(),
-				"connection string status", awi.Status_name[int32(appConn.GetStatus())])
-			if crd.Status == awi.Status_name[int32(appConn.GetStatus())] {
-				break
-			}
-			crd.Status = awi.Status_name[int32(appConn.GetStatus())]
-			err = k8sClient.Status().Update(ctx, &crd)
-			if err != nil {
-				logger.Error(err, "couldn't update InterNetworkDomainAppConnection CRD status",
-					"namespace", crd.GetNamespace(), "name", crd.GetName(),
-					"status", crd.Status)
-				break
-			}
-			break
+				"status", crd.Status)
+			continue
+		}
+	}
+	return true
+}
+
+func findAppConnection(appConnections []*awi.AppConnectionInformation,
+	crd *apiv1.InterNetworkDomainAppConnection) *awi.AppConnectionInformation {
+	for _, appConn := range appConnections {
+		config := appConn.GetAppConnectionConfig()
+		if !awiClient.MatchesAppConnection(config, &crd.Spec.AppConnection) {
+			continue
+		}
+		// spec stored in CRD has no identity labels, they're compared here
+		if namespace, ok := config.GetMetadata().GetLabel()[awiClient.OwnerNamespaceLabel]; ok &&
+			namespace != crd.GetNamespace() {
+			continue
 		}
+		return appConn
 	}
+	return nil
 }
@@ -24,6 +24,7 @@ import (
 	awiv1alpha1 "app-net-interface.io/kube-awi/api/awi/v1alpha1"
 	"app-net-interface.io/kube-awi/client"
 	awi "github.com/app-net-interface/awi-grpc/pb"
+	"github.com/go-logr/logr"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 	"github.com/stretchr/testify/mock"
@@ -52,29 +53,31 @@ var _ = Describe("Status watcher", func() {
 			connSvc := &awiv1alpha1.InterNetworkDomainConnection{
 				TypeMeta:   metav1.TypeMeta{APIVersion: "awi.app-net-interface.io/v1alpha1", Kind: "InterNetworkDomainConnection"},
 				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
-				Spec: awi.ConnectionRequest{
-					Metadata: &awi.ConnectionMetadata{},
-					Spec: &awi.NetworkDomainConnectionConfig{
-						Source: &awi.NetworkDomainConnectionConfig_Source{
-							NetworkDomain: &awi.NetworkDomainConnectionConfig_NetworkDomain{
-								Selector: &awi.NetworkDomainConnectionConfig_Selector{
-									MatchName: &awi.NetworkDomainConnectionConfig_MatchName{
-										Name: "AWS VPC development",
-									},
-									MatchId: &awi.NetworkDomainConnectionConfig_MatchId{
-										Id: "vpc-111",
+				Spec: awiv1alpha1.InterNetworkDomainConnectionSpec{
+					ConnectionRequest: awi.ConnectionRequest{
+						Metadata: &awi.ConnectionMetadata{},
+						Spec: &awi.NetworkDomainConnectionConfig{
+							Source: &awi.NetworkDomainConnectionConfig_Source{
+								NetworkDomain: &awi.NetworkDomainConnectionConfig_NetworkDomain{
+									Selector: &awi.NetworkDomainConnectionConfig_Selector{
+										MatchName: &awi.NetworkDomainConnectionConfig_MatchName{
+											Name: "AWS VPC development",
+										},
+										MatchId: &awi.NetworkDomainConnectionConfig_MatchId{
+											Id: "vpc-111",
+										},
 									},
 								},
 							},
-						},
-						Destination: &awi.NetworkDomainConnectionConfig_Destination{
-							NetworkDomain: &awi.NetworkDomainConnectionConfig_NetworkDomain{
-								Selector: &awi.NetworkDomainConnectionConfig_Selector{
-									MatchName: &awi.NetworkDomainConnectionConfig_MatchName{
-										Name: "VPN 10",
-									},
-									MatchId: &awi.NetworkDomainConnectionConfig_MatchId{
-										Id: "10",
+							Destination: &awi.NetworkDomainConnectionConfig_Destination{
+								NetworkDomain: &awi.NetworkDomainConnectionConfig_NetworkDomain{
+									Selector: &awi.NetworkDomainConnectionConfig_Selector{
+										MatchName: &awi.NetworkDomainConnectionConfig_MatchName{
+											Name: "VPN 10",
+										},
+										MatchId: &awi.NetworkDomainConnectionConfig_MatchId{
+											Id: "10",
+										},
 									},
 								},
 							},
@@ -110,7 +113,7 @@ var _ = Describe("Status watcher", func() {
 			}
 			ctxWithCancel, cancel := context.WithCancel(ctx)
 			defer cancel()
-			go WatchStatusUpdates(ctxWithCancel, awiClient, k8sClient, time.Millisecond*100)
+			go WatchStatusUpdates(ctxWithCancel, awiClient, k8sClient, time.Millisecond*100, nil)
 
 			Eventually(func() bool {
 				connObj := &awiv1alpha1.InterNetworkDomainConnection{}
@@ -121,6 +124,7 @@ var _ = Describe("Status watcher", func() {
 				}
 				return false
 			}, timeout, interval).Should(BeTrue())
+			Expect(PolledCheck(nil)).To(Succeed())
 
 			By("connection status updated in awi server should be updated in CRD")
 			mockConnectionController = awiMock.NewConnectionControllerClient(GinkgoT())
@@ -146,6 +150,31 @@ var _ = Describe("Status watcher", func() {
 				}
 				return false
 			}, timeout, interval).Should(BeTrue())
+
+			By("connection missing in awi server shouldn't be rematched by spec")
+			mockConnectionController = awiMock.NewConnectionControllerClient(GinkgoT())
+			mockConnectionController.On("ListConnections",
+				mock.Anything, mock.Anything).Return(&awi.ListConnectionsResponse{
+				Connections: []*awi.ConnectionInformation{
+					{
+						Id: "vpc-111:10-other",
+						Metadata: &awi.ConnectionMetadata{
+							Name: "example-conn",
+						},
+						Status: awi.Status_SUCCESS,
+					},
+				},
+			}, nil).Maybe()
+			awiClient.ConnectionControllerClient = mockConnectionController
+			Eventually(func() bool {
+				connObj := &awiv1alpha1.InterNetworkDomainConnection{}
+				err := k8sClient.Get(ctx, connLookupKey, connObj)
+				if err == nil && connObj.Status.ConnectionId == "vpc-111:10" &&
+					connObj.Status.State == awiv1alpha1.StateMissing {
+					return true
+				}
+				return false
+			}, timeout, interval).Should(BeTrue())
 		})
 
 		It("should update app connection status based on response from awi grpc server", func() {
@@ -253,12 +282,13 @@ var _ = Describe("Status watcher", func() {
 			}
 			ctxWithCancel, cancel := context.WithCancel(ctx)
 			defer cancel()
-			go WatchStatusUpdates(ctxWithCancel, awiClient, k8sClient, time.Millisecond*100)
+			go WatchStatusUpdates(ctxWithCancel, awiClient, k8sClient, time.Millisecond*100, nil)
 
 			Eventually(func() bool {
 				connObj := &awiv1alpha1.InterNetworkDomainAppConnection{}
 				err := k8sClient.Get(ctx, connLookupKey, connObj)
-				if err == nil && connObj.Status == "SUCCESS" {
+				// ID of app connection found by name is stored in CRD
+				if err == nil && connObj.Status.State == "SUCCESS" && connObj.Status.ConnectionId == "this_is_random" {
 					return true
 				}
 				return false
@@ -305,11 +335,70 @@ var _ = Describe("Status watcher", func() {
 			Eventually(func() bool {
 				connObj := &awiv1alpha1.InterNetworkDomainAppConnection{}
 				err := k8sClient.Get(ctx, connLookupKey, connObj)
-				if err == nil && connObj.Status == "FAILED" {
+				if err == nil && connObj.Status.State == "FAILED" {
 					return true
 				}
 				return false
 			}, timeout, interval).Should(BeTrue())
+
+			By("app connection missing in awi server shouldn't be rematched by name")
+			mockAppConnectionController = awiMock.NewAppConnectionControllerClient(GinkgoT())
+			mockAppConnectionController.On("ListConnectedApps",
+				mock.Anything, mock.Anything).Return(&awi.ListAppConnectionsResponse{
+				AppConnections: []*awi.AppConnectionInformation{
+					{
+						Id: "recreated_elsewhere",
+						AppConnectionConfig: &awi.AppConnection{
+							Metadata: &awi.AppMetadata{
+								Name: appConnName,
+							},
+						},
+						Status: awi.Status_SUCCESS,
+					},
+				},
+			}, nil).Maybe()
+			awiClient.AppConnectionControllerClient = mockAppConnectionController
+			Eventually(func() bool {
+				connObj := &awiv1alpha1.InterNetworkDomainAppConnection{}
+				err := k8sClient.Get(ctx, connLookupKey, connObj)
+				if err == nil && connObj.Status.ConnectionId == "this_is_random" &&
+					connObj.Status.State == awiv1alpha1.StateMissing {
+					return true
+				}
+				return false
+			}, timeout, interval).Should(BeTrue())
+		})
+
+		It("shouldn't mark connection whose ID was stored while AWI was listed as missing", func() {
+			const storedName = "conn-stored-meanwhile"
+			ctx := context.Background()
+			connSvc := &awiv1alpha1.InterNetworkDomainConnection{
+				ObjectMeta: metav1.ObjectMeta{Name: storedName, Namespace: namespace},
+				Spec: awiv1alpha1.InterNetworkDomainConnectionSpec{
+					ConnectionRequest: awi.ConnectionRequest{
+						Metadata: &awi.ConnectionMetadata{Name: storedName},
+					},
+				},
+			}
+			Expect(k8sClient.Create(ctx, connSvc)).Should(Succeed())
+
+			// the controller stores the ID of the connection it has just
+			// created after AWI returned the list without it
+			mockConnectionController := awiMock.NewConnectionControllerClient(GinkgoT())
+			mockConnectionController.On("ListConnections", mock.Anything, mock.Anything).
+				Run(func(_ mock.Arguments) {
+					connSvc.Status.ConnectionId = "stored-meanwhile"
+					Expect(k8sClient.Status().Update(ctx, connSvc)).Should(Succeed())
+				}).
+				Return(&awi.ListConnectionsResponse{}, nil).Once()
+			awiClient := &client.AwiGrpcClient{ConnectionControllerClient: mockConnectionController}
+
+			Expect(checkConnectionsStatuses(ctx, awiClient, logr.Discard(), k8sClient, nil)).To(BeTrue())
+			connObj := &awiv1alpha1.InterNetworkDomainConnection{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: storedName, Namespace: namespace}, connObj)).
+				Should(Succeed())
+			Expect(connObj.Status.ConnectionId).To(Equal("stored-meanwhile"))
+			Expect(connObj.Status.State).NotTo(Equal(awiv1alpha1.StateMissing))
 		})
 	})
 })
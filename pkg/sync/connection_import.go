@@ -0,0 +1,177 @@
+// Copyright (c) 2023 Cisco Systems, Inc. and its affiliates
+// All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http:www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+package sync
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"google.golang.org/protobuf/proto"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8s_cl "sigs.k8s.io/controller-runtime/pkg/client"
+
+	apiv1 "app-net-interface.io/kube-awi/api/awi/v1alpha1"
+	awi_cl "app-net-interface.io/kube-awi/client"
+	awi "github.com/app-net-interface/awi-grpc/pb"
+)
+
+// ConnectionImporter creates InterNetworkDomainConnections and
+// InterNetworkDomainAppConnections adopting connections which were created
+// in AWI outside of Kubernetes, e.g. with Catalyst SD-WAN UI.
+type ConnectionImporter struct {
+	k8sClient k8s_cl.Client
+	awiClient *awi_cl.AwiGrpcClient
+	logger    logr.Logger
+	// DeletionPolicy is set on adopted objects, with DeletionPolicyRetain
+	// removing them doesn't remove connections from AWI
+	DeletionPolicy string
+}
+
+func (s *ConnectionImporter) Sync(ctx context.Context) error {
+	if err := s.importConnections(ctx); err != nil {
+		return err
+	}
+	return s.importAppConnections(ctx)
+}
+
+func (s *ConnectionImporter) importConnections(ctx context.Context) error {
+	existingConnections, err := s.awiClient.ListConnections(ctx)
+	if err != nil {
+		return err
+	}
+
+	// objects without stored ID are matched by spec
+	var unidentifiedList apiv1.InterNetworkDomainConnectionList
+	err = s.k8sClient.List(ctx, &unidentifiedList, k8s_cl.MatchingFields{ConnectionIDField: ""})
+	if err != nil {
+		return err
+	}
+
+	for _, conn := range existingConnections {
+		var managingList apiv1.InterNetworkDomainConnectionList
+		err = s.k8sClient.List(ctx, &managingList, k8s_cl.MatchingFields{ConnectionIDField: conn.GetId()})
+		if err != nil {
+			return err
+		}
+		if len(managingList.Items) > 0 || connectionManaged(conn, unidentifiedList.Items) {
+			continue
+		}
+		newConnectionCRD := apiv1.InterNetworkDomainConnection{
+			ObjectMeta: s.importedObjectMeta("imported-", conn.GetId()),
+			Spec: apiv1.InterNetworkDomainConnectionSpec{
+				ConnectionRequest: awi.ConnectionRequest{
+					Metadata: proto.Clone(conn.GetMetadata()).(*awi.ConnectionMetadata),
+					Spec:     proto.Clone(conn.GetConfig()).(*awi.NetworkDomainConnectionConfig),
+				},
+			},
+		}
+		s.logger.Info("Adopting connection", "id", conn.GetId(), "name", newConnectionCRD.GetName())
+		err := s.k8sClient.Create(ctx, &newConnectionCRD)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *ConnectionImporter) importAppConnections(ctx context.Context) error {
+	existingAppConnections, err := s.awiClient.ListAppConnections(ctx)
+	if err != nil {
+		return err
+	}
+
+	// objects without stored ID are matched by spec
+	var unidentifiedList apiv1.InterNetworkDomainAppConnectionList
+	err = s.k8sClient.List(ctx, &unidentifiedList, k8s_cl.MatchingFields{ConnectionIDField: ""})
+	if err != nil {
+		return err
+	}
+
+	for _, appConn := range existingAppConnections {
+		var managingList apiv1.InterNetworkDomainAppConnectionList
+		err = s.k8sClient.List(ctx, &managingList, k8s_cl.MatchingFields{ConnectionIDField: appConn.GetId()})
+		if err != nil {
+			return err
+		}
+		if len(managingList.Items) > 0 || appConnectionManaged(appConn, unidentifiedList.Items) {
+			continue
+		}
+		newAppConnectionCRD := apiv1.InterNetworkDomainAppConnection{
+			ObjectMeta: s.importedObjectMeta("imported-app-", appConn.GetId()),
+			Spec: apiv1.AppConnectionSpec{
+				AppConnection: *proto.Clone(appConn.GetAppConnectionConfig()).(*awi.AppConnection),
+			},
+		}
+		s.logger.Info("Adopting app connection", "id", appConn.GetId(), "name", newAppConnectionCRD.GetName())
+		err := s.k8sClient.Create(ctx, &newAppConnectionCRD)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *ConnectionImporter) importedObjectMeta(prefix, id string) metav1.ObjectMeta {
+	return metav1.ObjectMeta{
+		Name:      getImportedCRDName(prefix, id),
+		Namespace: Namespace,
+		Annotations: map[string]string{
+			apiv1.AdoptedConnectionIdAnnotation: id,
+			apiv1.DeletionPolicyAnnotation:      s.DeletionPolicy,
+		},
+	}
+}
+
+// connectionManaged checks if the connection was created by the operator,
+// maybe in another cluster, or for any of the CRDs without stored ID, by
+// older version of the operator
+func connectionManaged(conn *awi.ConnectionInformation, unidentified []apiv1.InterNetworkDomainConnection) bool {
+	if _, ok := conn.GetMetadata().GetLabels()[awi_cl.OwnerUIDLabel]; ok {
+		return true
+	}
+	for i := range unidentified {
+		if awi_cl.MatchesConnection(conn, &unidentified[i].Spec.ConnectionRequest) {
+			return true
+		}
+	}
+	return false
+}
+
+// appConnectionManaged checks if the app connection was created by the
+// operator, maybe in another cluster, or for any of the CRDs without
+// stored ID, by older version of the operator
+func appConnectionManaged(appConn *awi.AppConnectionInformation, unidentified []apiv1.InterNetworkDomainAppConnection) bool {
+	if _, ok := appConn.GetAppConnectionConfig().GetMetadata().GetLabel()[awi_cl.OwnerUIDLabel]; ok {
+		return true
+	}
+	for i := range unidentified {
+		if awi_cl.MatchesAppConnection(appConn.GetAppConnectionConfig(), &unidentified[i].Spec.AppConnection) {
+			return true
+		}
+	}
+	return false
+}
+
+var invalidNameCharacters = regexp.MustCompile("[^a-z0-9.-]+")
+
+func getImportedCRDName(prefix, id string) string {
+	name := strings.Trim(invalidNameCharacters.ReplaceAllString(strings.ToLower(id), "-"), "-.")
+	return fmt.Sprintf("%s%s", prefix, name)
+}
@@ -0,0 +1,162 @@
+// Copyright (c) 2023 Cisco Systems, Inc. and its affiliates
+// All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http:www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package sync
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+
+	awi "github.com/app-net-interface/awi-grpc/pb"
+)
+
+// DiscoveryFilters select which discovered objects of each kind are
+// mirrored into the cluster, objects which stop matching are removed
+type DiscoveryFilters struct {
+	VPCs      Filter `json:"vpcs,omitempty"`
+	Subnets   Filter `json:"subnets,omitempty"`
+	Instances Filter `json:"instances,omitempty"`
+}
+
+// Filter keeps objects matching any of Include, or all objects if it's
+// empty, unless they match any of Exclude
+type Filter struct {
+	Include []Match `json:"include,omitempty"`
+	Exclude []Match `json:"exclude,omitempty"`
+}
+
+// Match matches objects which match all of its set fields, a list field
+// matches if any of its values does. Subnets and instances are matched
+// by region and account of their VPC.
+type Match struct {
+	Providers []string `json:"providers,omitempty"`
+	Regions   []string `json:"regions,omitempty"`
+	VPCIDs    []string `json:"vpcIds,omitempty"`
+	Accounts  []string `json:"accounts,omitempty"`
+	// Tags must all be set on the object, an empty value matches any value
+	Tags map[string]string `json:"tags,omitempty"`
+}
+
+// LoadDiscoveryFilters reads filters from the YAML file
+func LoadDiscoveryFilters(path string) (*DiscoveryFilters, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	filters := &DiscoveryFilters{}
+	if err := yaml.UnmarshalStrict(data, filters); err != nil {
+		return nil, fmt.Errorf("invalid discovery filters in %s: %w", path, err)
+	}
+	return filters, nil
+}
+
+// discoveredObject holds attributes of a discovered object filters are
+// matched against
+type discoveredObject struct {
+	provider string
+	region   string
+	vpcID    string
+	account  string
+	tags     map[string]string
+}
+
+func vpcObject(vpc *awi.VPC) discoveredObject {
+	return discoveredObject{
+		provider: vpc.GetProvider(),
+		region:   vpc.GetRegion(),
+		vpcID:    vpc.GetID(),
+		account:  vpc.GetAccountName(),
+		tags:     vpc.GetLabels(),
+	}
+}
+
+// vpcKey identifies a VPC, IDs are unique only within a provider
+type vpcKey struct {
+	provider string
+	id       string
+}
+
+// inVPC returns attributes of an object in the VPC, vpcs are needed only
+// if filters match regions or accounts
+func inVPC(provider, vpcID string, tags map[string]string, vpcs map[vpcKey]*awi.VPC) discoveredObject {
+	obj := discoveredObject{provider: provider, vpcID: vpcID, tags: tags}
+	if vpc, ok := vpcs[vpcKey{provider: provider, id: vpcID}]; ok {
+		obj.region = vpc.GetRegion()
+		obj.account = vpc.GetAccountName()
+	}
+	return obj
+}
+
+func (f *Filter) matches(obj discoveredObject) bool {
+	if len(f.Include) > 0 && !slices.ContainsFunc(f.Include, func(m Match) bool { return m.matches(obj) }) {
+		return false
+	}
+	return !slices.ContainsFunc(f.Exclude, func(m Match) bool { return m.matches(obj) })
+}
+
+// needsVPCs checks if the filter matches attributes which subnets and
+// instances get from their VPC
+func (f *Filter) needsVPCs() bool {
+	for _, m := range append(slices.Clone(f.Include), f.Exclude...) {
+		if len(m.Regions) > 0 || len(m.Accounts) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Match) matches(obj discoveredObject) bool {
+	if !matchesAny(m.Providers, obj.provider) || !matchesAny(m.Regions, obj.region) ||
+		!matchesAny(m.VPCIDs, obj.vpcID) || !matchesAny(m.Accounts, obj.account) {
+		return false
+	}
+	for key, value := range m.Tags {
+		tag, ok := obj.tags[key]
+		if !ok || (value != "" && tag != value) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchesAny(values []string, value string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(values, func(v string) bool { return strings.EqualFold(v, value) })
+}
+
+// vpcsByID lists VPCs of all supported clouds by their providers and IDs
+func vpcsByID(ctx context.Context, list func(ctx context.Context, cloud string) ([]*awi.VPC, error),
+	workers pool) (map[vpcKey]*awi.VPC, error) {
+	cloudVPCs, err := listPerCloud(ctx, workers, list)
+	if err != nil {
+		return nil, err
+	}
+	vpcs := map[vpcKey]*awi.VPC{}
+	for i, list := range cloudVPCs {
+		for _, vpc := range list {
+			vpcs[vpcKey{provider: SupportedClouds[i], id: vpc.GetID()}] = vpc
+		}
+	}
+	return vpcs, nil
+}
@@ -0,0 +1,143 @@
+// Copyright (c) 2023 Cisco Systems, Inc. and its affiliates
+// All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http:www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package sync
+
+import (
+	"context"
+	"testing"
+
+	awi "github.com/app-net-interface/awi-grpc/pb"
+)
+
+func TestFilterMatches(t *testing.T) {
+	obj := discoveredObject{
+		provider: "AWS",
+		region:   "us-east-1",
+		vpcID:    "vpc-1",
+		account:  "production",
+		tags:     map[string]string{"env": "prod", "team": "ml"},
+	}
+	tests := []struct {
+		name   string
+		filter Filter
+		want   bool
+	}{
+		{name: "empty filter", filter: Filter{}, want: true},
+		{name: "provider", filter: Filter{Include: []Match{{Providers: []string{"aws"}}}}, want: true},
+		{name: "other provider", filter: Filter{Include: []Match{{Providers: []string{"GCP"}}}}, want: false},
+		{name: "region", filter: Filter{Include: []Match{{Regions: []string{"eu-west-1", "us-east-1"}}}}, want: true},
+		{name: "other region", filter: Filter{Include: []Match{{Regions: []string{"eu-west-1"}}}}, want: false},
+		{name: "vpc", filter: Filter{Include: []Match{{VPCIDs: []string{"vpc-1"}}}}, want: true},
+		{name: "other vpc", filter: Filter{Include: []Match{{VPCIDs: []string{"vpc-2"}}}}, want: false},
+		{name: "account", filter: Filter{Include: []Match{{Accounts: []string{"Production"}}}}, want: true},
+		{name: "other account", filter: Filter{Include: []Match{{Accounts: []string{"staging"}}}}, want: false},
+		{name: "tag value", filter: Filter{Include: []Match{{Tags: map[string]string{"env": "prod"}}}}, want: true},
+		{name: "tag any value", filter: Filter{Include: []Match{{Tags: map[string]string{"team": ""}}}}, want: true},
+		{name: "other tag value", filter: Filter{Include: []Match{{Tags: map[string]string{"env": "dev"}}}}, want: false},
+		{name: "missing tag", filter: Filter{Include: []Match{{Tags: map[string]string{"owner": ""}}}}, want: false},
+		{
+			name: "all fields of match",
+			filter: Filter{Include: []Match{{
+				Providers: []string{"AWS"},
+				Regions:   []string{"us-east-1"},
+				Tags:      map[string]string{"env": "dev"},
+			}}},
+			want: false,
+		},
+		{
+			name: "any of include",
+			filter: Filter{Include: []Match{
+				{Providers: []string{"GCP"}},
+				{Accounts: []string{"production"}},
+			}},
+			want: true,
+		},
+		{name: "exclude", filter: Filter{Exclude: []Match{{Tags: map[string]string{"env": "prod"}}}}, want: false},
+		{
+			name: "exclude over include",
+			filter: Filter{
+				Include: []Match{{Providers: []string{"AWS"}}},
+				Exclude: []Match{{VPCIDs: []string{"vpc-1"}}},
+			},
+			want: false,
+		},
+		{name: "other exclude", filter: Filter{Exclude: []Match{{Regions: []string{"eu-west-1"}}}}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.matches(obj); got != tt.want {
+				t.Errorf("matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterNeedsVPCs(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter Filter
+		want   bool
+	}{
+		{name: "empty filter", filter: Filter{}, want: false},
+		{name: "provider", filter: Filter{Include: []Match{{Providers: []string{"AWS"}}}}, want: false},
+		{name: "vpc and tag", filter: Filter{Include: []Match{{VPCIDs: []string{"vpc-1"}, Tags: map[string]string{"env": ""}}}}, want: false},
+		{name: "region", filter: Filter{Include: []Match{{Regions: []string{"us-east-1"}}}}, want: true},
+		{name: "excluded account", filter: Filter{Exclude: []Match{{Accounts: []string{"staging"}}}}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.needsVPCs(); got != tt.want {
+				t.Errorf("needsVPCs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInVPC(t *testing.T) {
+	vpcs, err := vpcsByID(context.Background(), func(_ context.Context, cloud string) ([]*awi.VPC, error) {
+		// the same ID in both clouds
+		if cloud == "AWS" {
+			return []*awi.VPC{{ID: "vpc-1", Provider: cloud, Region: "us-east-1", AccountName: "aws-account"}}, nil
+		}
+		return []*awi.VPC{{ID: "vpc-1", Provider: cloud, Region: "us-central1", AccountName: "gcp-project"}}, nil
+	}, newPool(1))
+	if err != nil {
+		t.Fatalf("vpcsByID() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		provider string
+		vpcID    string
+		region   string
+		account  string
+	}{
+		{name: "aws", provider: "AWS", vpcID: "vpc-1", region: "us-east-1", account: "aws-account"},
+		{name: "gcp", provider: "GCP", vpcID: "vpc-1", region: "us-central1", account: "gcp-project"},
+		{name: "unknown vpc", provider: "AWS", vpcID: "vpc-2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := inVPC(tt.provider, tt.vpcID, nil, vpcs)
+			if obj.region != tt.region || obj.account != tt.account {
+				t.Errorf("inVPC() region, account = %q, %q, want %q, %q",
+					obj.region, obj.account, tt.region, tt.account)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2023 Cisco Systems, Inc. and its affiliates
+// All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http:www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package sync
+
+import (
+	"context"
+	"errors"
+
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	k8s_cl "sigs.k8s.io/controller-runtime/pkg/client"
+
+	apiv1 "app-net-interface.io/kube-awi/api/awi/v1alpha1"
+)
+
+// ConnectionIDField indexes InterNetworkDomainConnections and
+// InterNetworkDomainAppConnections by IDs of the AWI connections they
+// stand for, the stored one and the adopted one. Objects with neither
+// are indexed under an empty ID.
+const ConnectionIDField = "status.connectionId"
+
+// SetupIndexes registers field indexes used by syncers, they need the
+// manager's cached client
+func SetupIndexes(ctx context.Context, indexer k8s_cl.FieldIndexer) error {
+	if err := indexer.IndexField(ctx, &apiv1.InterNetworkDomainConnection{}, ConnectionIDField,
+		func(obj k8s_cl.Object) []string {
+			return connectionIDs(obj, obj.(*apiv1.InterNetworkDomainConnection).Status.ConnectionId)
+		}); err != nil {
+		return err
+	}
+	return indexer.IndexField(ctx, &apiv1.InterNetworkDomainAppConnection{}, ConnectionIDField,
+		func(obj k8s_cl.Object) []string {
+			return connectionIDs(obj, obj.(*apiv1.InterNetworkDomainAppConnection).Status.ConnectionId)
+		})
+}
+
+func connectionIDs(obj k8s_cl.Object, storedID string) []string {
+	var ids []string
+	if storedID != "" {
+		ids = append(ids, storedID)
+	}
+	if adoptedID := obj.GetAnnotations()[apiv1.AdoptedConnectionIdAnnotation]; adoptedID != "" && adoptedID != storedID {
+		ids = append(ids, adoptedID)
+	}
+	if len(ids) == 0 {
+		return []string{""}
+	}
+	return ids
+}
+
+// WaitForInformers starts informers of the given kinds in the cache and
+// waits until they're synced, so periodic lists are served from the cache
+// instead of the API server and don't race its warm-up
+func WaitForInformers(ctx context.Context, c cache.Cache, objs ...k8s_cl.Object) error {
+	for _, obj := range objs {
+		if _, err := c.GetInformer(ctx, obj); err != nil {
+			return err
+		}
+	}
+	if !c.WaitForCacheSync(ctx) {
+		return errors.New("cache didn't sync")
+	}
+	return nil
+}
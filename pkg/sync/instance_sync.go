@@ -20,10 +20,11 @@ package sync
 import (
 	"context"
 	"fmt"
+	"slices"
 	"strings"
-	"time"
 
 	"github.com/go-logr/logr"
+	"google.golang.org/protobuf/proto"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	k8s_cl "sigs.k8s.io/controller-runtime/pkg/client"
 
@@ -36,6 +37,11 @@ type InstanceSyncer struct {
 	k8sClient k8s_cl.Client
 	awiClient *awi_cl.AwiGrpcClient
 	logger    logr.Logger
+	// workers is shared by all syncers, it bounds how many clouds are
+	// listed at the same time
+	workers pool
+	// filter selects which of discovered objects are synced
+	filter Filter
 }
 
 type instanceWithProvider struct {
@@ -47,19 +53,16 @@ type instanceWithProvider struct {
 //+kubebuilder:rbac:groups=awi.app-net-interface.io,resources=instances/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=awi.app-net-interface.io,resources=instances/finalizers,verbs=update
 
-func (s *InstanceSyncer) Sync() error {
-	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
-	defer cancel()
-
+func (s *InstanceSyncer) Sync(ctx context.Context) error {
 	var err error
 
 	var existingInstances []instanceWithProvider
-	for _, cloud := range SupportedClouds {
-		cloudInstances, err := s.awiClient.ListInstances(cloud)
-		if err != nil {
-			return err
-		}
-		for _, instance := range cloudInstances {
+	cloudInstances, err := listPerCloud(ctx, s.workers, s.awiClient.ListInstances)
+	if err != nil {
+		return err
+	}
+	for i, cloud := range SupportedClouds {
+		for _, instance := range cloudInstances[i] {
 			withProvider := instanceWithProvider{
 				Instance: instance,
 				Provider: cloud,
@@ -68,6 +71,17 @@ func (s *InstanceSyncer) Sync() error {
 		}
 	}
 
+	var vpcs map[vpcKey]*awi.VPC
+	if s.filter.needsVPCs() {
+		vpcs, err = vpcsByID(ctx, s.awiClient.ListVPCs, s.workers)
+		if err != nil {
+			return err
+		}
+	}
+	existingInstances = slices.DeleteFunc(existingInstances, func(instance instanceWithProvider) bool {
+		return !s.filter.matches(inVPC(instance.Provider, instance.Instance.GetVPCID(), instance.Instance.GetLabels(), vpcs))
+	})
+
 	var instanceList apiv1.InstanceList
 	err = s.k8sClient.List(ctx, &instanceList, k8s_cl.InNamespace(Namespace))
 	if err != nil {
@@ -79,10 +93,18 @@ func (s *InstanceSyncer) Sync() error {
 	}
 
 	for _, instance := range existingInstances {
-		_, ok := instanceCRDMap[getInstanceCRDName(instance)]
+		existing, ok := instanceCRDMap[getInstanceCRDName(instance)]
 		if ok {
 			// if it's already present remove it from map
 			delete(instanceCRDMap, getInstanceCRDName(instance))
+			if proto.Equal(&existing.Spec, instance.Instance) {
+				continue
+			}
+			existing.Spec = *instance.Instance
+			s.logger.Info("Updating changed Instance CRD", "name", existing.GetName())
+			if err := s.k8sClient.Update(ctx, &existing); err != nil {
+				return err
+			}
 			continue
 		}
 		newInstanceCRD := apiv1.Instance{
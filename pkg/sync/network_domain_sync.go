@@ -21,7 +21,6 @@ import (
 	"context"
 	"fmt"
 	"strings"
-	"time"
 
 	"github.com/go-logr/logr"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -41,10 +40,7 @@ type NetworkDomainSyncer struct {
 }
 
 // Sync creates NetworkDomains which are based on existing VPCs and VPNs CRDs
-func (s *NetworkDomainSyncer) Sync() error {
-	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
-	defer cancel()
-
+func (s *NetworkDomainSyncer) Sync(ctx context.Context) error {
 	var vpcList apiv1.VPCList
 	err := s.k8sClient.List(ctx, &vpcList, k8sclient.InNamespace(Namespace))
 	if err != nil {
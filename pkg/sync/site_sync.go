@@ -21,9 +21,9 @@ import (
 	"context"
 	"fmt"
 	"strings"
-	"time"
 
 	"github.com/go-logr/logr"
+	"google.golang.org/protobuf/proto"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	k8s_cl "sigs.k8s.io/controller-runtime/pkg/client"
 
@@ -42,10 +42,8 @@ type SiteSyncer struct {
 	logger    logr.Logger
 }
 
-func (s *SiteSyncer) Sync() error {
-	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
-	defer cancel()
-	existingSites, err := s.awiClient.ListSites()
+func (s *SiteSyncer) Sync(ctx context.Context) error {
+	existingSites, err := s.awiClient.ListSites(ctx)
 	if err != nil {
 		return err
 	}
@@ -61,10 +59,18 @@ func (s *SiteSyncer) Sync() error {
 	}
 
 	for _, site := range existingSites {
-		_, ok := siteCRDMap[getSiteCRDName(site)]
+		existing, ok := siteCRDMap[getSiteCRDName(site)]
 		if ok {
 			// if it's already present remove it from map
 			delete(siteCRDMap, getSiteCRDName(site))
+			if proto.Equal(&existing.Spec, site) {
+				continue
+			}
+			existing.Spec = *site
+			s.logger.Info("Updating changed Site CRD", "name", existing.GetName())
+			if err := s.k8sClient.Update(ctx, &existing); err != nil {
+				return err
+			}
 			continue
 		}
 		newSiteCRD := apiv1.Site{
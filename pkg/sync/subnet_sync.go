@@ -20,10 +20,11 @@ package sync
 import (
 	"context"
 	"fmt"
+	"slices"
 	"strings"
-	"time"
 
 	"github.com/go-logr/logr"
+	"google.golang.org/protobuf/proto"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	k8s_cl "sigs.k8s.io/controller-runtime/pkg/client"
 
@@ -40,6 +41,11 @@ type SubnetSyncer struct {
 	k8sClient k8s_cl.Client
 	awiClient *awi_cl.AwiGrpcClient
 	logger    logr.Logger
+	// workers is shared by all syncers, it bounds how many clouds are
+	// listed at the same time
+	workers pool
+	// filter selects which of discovered objects are synced
+	filter Filter
 }
 
 type subnetWithProvider struct {
@@ -47,19 +53,16 @@ type subnetWithProvider struct {
 	Provider string
 }
 
-func (s *SubnetSyncer) Sync() error {
-	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
-	defer cancel()
-
+func (s *SubnetSyncer) Sync(ctx context.Context) error {
 	var err error
 
 	var existingSubnets []subnetWithProvider
-	for _, cloud := range SupportedClouds {
-		cloudSubnets, err := s.awiClient.ListSubnets(cloud)
-		if err != nil {
-			return err
-		}
-		for _, subnet := range cloudSubnets {
+	cloudSubnets, err := listPerCloud(ctx, s.workers, s.awiClient.ListSubnets)
+	if err != nil {
+		return err
+	}
+	for i, cloud := range SupportedClouds {
+		for _, subnet := range cloudSubnets[i] {
 			withProvider := subnetWithProvider{
 				Subnet:   subnet,
 				Provider: cloud,
@@ -68,6 +71,17 @@ func (s *SubnetSyncer) Sync() error {
 		}
 	}
 
+	var vpcs map[vpcKey]*awi.VPC
+	if s.filter.needsVPCs() {
+		vpcs, err = vpcsByID(ctx, s.awiClient.ListVPCs, s.workers)
+		if err != nil {
+			return err
+		}
+	}
+	existingSubnets = slices.DeleteFunc(existingSubnets, func(subnet subnetWithProvider) bool {
+		return !s.filter.matches(inVPC(subnet.Provider, subnet.Subnet.GetVpcId(), subnet.Subnet.GetLabels(), vpcs))
+	})
+
 	var subnetList apiv1.SubnetList
 	err = s.k8sClient.List(ctx, &subnetList, k8s_cl.InNamespace(Namespace))
 	if err != nil {
@@ -79,10 +93,18 @@ func (s *SubnetSyncer) Sync() error {
 	}
 
 	for _, subnet := range existingSubnets {
-		_, ok := subnetCRDMap[getSubnetCRDName(subnet)]
+		existing, ok := subnetCRDMap[getSubnetCRDName(subnet)]
 		if ok {
 			// if it's already present remove it from map
 			delete(subnetCRDMap, getSubnetCRDName(subnet))
+			if proto.Equal(&existing.Spec, subnet.Subnet) {
+				continue
+			}
+			existing.Spec = *subnet.Subnet
+			s.logger.Info("Updating changed Subnet CRD", "name", existing.GetName())
+			if err := s.k8sClient.Update(ctx, &existing); err != nil {
+				return err
+			}
 			continue
 		}
 		newSubnetCRD := apiv1.Subnet{
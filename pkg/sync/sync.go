@@ -19,13 +19,22 @@ package sync
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"sync/atomic"
 	"time"
 
+	apiv1 "app-net-interface.io/kube-awi/api/awi/v1alpha1"
 	awi_cl "app-net-interface.io/kube-awi/client"
+	"app-net-interface.io/kube-awi/pkg/tracing"
 	"github.com/go-logr/logr"
+	"go.opentelemetry.io/otel/attribute"
+	"k8s.io/apimachinery/pkg/util/wait"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	k8s_cl "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
 )
 
 // TODO make configurable
@@ -33,25 +42,54 @@ var SupportedClouds = []string{"AWS", "GCP"}
 
 const Namespace = "awi-system"
 
+// DefaultSyncInterval is how often all objects are listed in AWI, AWI
+// has no way to watch them or list only the changed ones
+const DefaultSyncInterval = 60 * time.Second
+
+// DefaultSyncTimeout limits how long a single sync of all objects takes
+const DefaultSyncTimeout = 5 * time.Minute
+
 type Syncer interface {
-	Sync() error
+	Sync(ctx context.Context) error
 }
 
+var _ manager.LeaderElectionRunnable = &Syncers{}
+var _ manager.Runnable = &Syncers{}
+
 type Syncers struct {
 	allSyncers []Syncer
-	logger     logr.Logger
+	// derivedSyncers build objects out of the ones synced by allSyncers,
+	// they're run once all of those are done
+	derivedSyncers []Syncer
+	logger         logr.Logger
+	interval       time.Duration
+	timeout        time.Duration
+	workers        pool
+	cache          cache.Cache
+	// synced is set once all syncers succeeded in a single run
+	synced atomic.Bool
 }
 
-func NewSyncers(k8sClient k8s_cl.Client, awiClient *awi_cl.AwiGrpcClient) *Syncers {
+// NewSyncers creates syncers of all objects discovered in AWI, making at
+// most workers AWI calls at the same time
+func NewSyncers(k8sClient k8s_cl.Client, awiClient *awi_cl.AwiGrpcClient, workers int) *Syncers {
 	logger := ctrl.Log.WithName("sync-logger")
+	if workers <= 0 {
+		workers = DefaultSyncWorkers
+	}
+	calls := newPool(workers)
 	syncers := &Syncers{
-		logger: logger,
+		logger:   logger,
+		interval: DefaultSyncInterval,
+		timeout:  DefaultSyncTimeout,
+		workers:  calls,
 	}
 	syncers.allSyncers = []Syncer{
 		&InstanceSyncer{
 			k8sClient: k8sClient,
 			awiClient: awiClient,
 			logger:    logger,
+			workers:   calls,
 		},
 		&SiteSyncer{
 			k8sClient: k8sClient,
@@ -62,17 +100,21 @@ func NewSyncers(k8sClient k8s_cl.Client, awiClient *awi_cl.AwiGrpcClient) *Synce
 			k8sClient: k8sClient,
 			awiClient: awiClient,
 			logger:    logger,
+			workers:   calls,
 		},
 		&VPCSyncer{
 			k8sClient: k8sClient,
 			awiClient: awiClient,
 			logger:    logger,
+			workers:   calls,
 		},
 		&VPNSyncer{
 			k8sClient: k8sClient,
 			awiClient: awiClient,
 			logger:    logger,
 		},
+	}
+	syncers.derivedSyncers = []Syncer{
 		&NetworkDomainSyncer{
 			k8sClient: k8sClient,
 			logger:    logger,
@@ -81,28 +123,127 @@ func NewSyncers(k8sClient k8s_cl.Client, awiClient *awi_cl.AwiGrpcClient) *Synce
 	return syncers
 }
 
-func (s *Syncers) Sync() {
-	s.logger.Info("Starting to sync objects...")
+// WithConnectionImport adds syncer adopting connections created in AWI
+// outside of Kubernetes, adopted objects get the given deletion policy.
+func (s *Syncers) WithConnectionImport(k8sClient k8s_cl.Client, awiClient *awi_cl.AwiGrpcClient,
+	deletionPolicy string) *Syncers {
+	s.allSyncers = append(s.allSyncers, &ConnectionImporter{
+		k8sClient:      k8sClient,
+		awiClient:      awiClient,
+		logger:         s.logger,
+		DeletionPolicy: deletionPolicy,
+	})
+	return s
+}
+
+// WithInterval sets how often objects are synced, the default one is kept
+// if it's not positive
+func (s *Syncers) WithInterval(interval time.Duration) *Syncers {
+	if interval > 0 {
+		s.interval = interval
+	}
+	return s
+}
+
+// WithTimeout sets how long a single sync of all objects may take, the
+// default one is kept if it's not positive
+func (s *Syncers) WithTimeout(timeout time.Duration) *Syncers {
+	if timeout > 0 {
+		s.timeout = timeout
+	}
+	return s
+}
+
+// WithFilters makes syncers of VPCs, subnets and instances sync only
+// objects selected by the filters, the others are removed
+func (s *Syncers) WithFilters(filters *DiscoveryFilters) *Syncers {
 	for _, syncer := range s.allSyncers {
+		switch syncer := syncer.(type) {
+		case *VPCSyncer:
+			syncer.filter = filters.VPCs
+		case *SubnetSyncer:
+			syncer.filter = filters.Subnets
+		case *InstanceSyncer:
+			syncer.filter = filters.Instances
+		}
+	}
+	return s
+}
+
+// WithCache makes syncers wait until the cache backing their client has
+// synced the listed kinds before the first sync
+func (s *Syncers) WithCache(c cache.Cache) *Syncers {
+	s.cache = c
+	return s
+}
+
+// Sync runs all syncers, making at most workers AWI calls at the same time
+func (s *Syncers) Sync(ctx context.Context) {
+	s.logger.Info("Starting to sync objects...")
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	ctx, span := tracing.Start(ctx, "Syncers.Sync")
+	defer span.End()
+	ok := s.run(ctx, s.allSyncers)
+	ok = s.run(ctx, s.derivedSyncers) && ok
+	if ok {
+		s.synced.Store(true)
+	}
+}
+
+// run runs the syncers concurrently and reports if all of them succeeded
+func (s *Syncers) run(ctx context.Context, syncers []Syncer) bool {
+	var failed atomic.Bool
+	s.workers.forEach(len(syncers), func(i int) {
+		syncer := syncers[i]
 		s.logger.Info("Syncing", "syncer", fmt.Sprintf("%T", syncer))
-		err := syncer.Sync()
+		syncCtx, syncSpan := tracing.Start(ctx, "Syncer.Sync",
+			attribute.String("syncer", fmt.Sprintf("%T", syncer)))
+		err := syncer.Sync(syncCtx)
+		tracing.End(syncSpan, err)
 		if err != nil {
 			s.logger.Error(err, fmt.Sprintf("Failure during sync of %T", syncer))
+			failed.Store(true)
 		}
+	})
+	return !failed.Load()
+}
+
+// SyncedCheck is a readiness check passing once all objects were synced
+// successfully at least once
+func (s *Syncers) SyncedCheck(_ *http.Request) error {
+	if !s.synced.Load() {
+		return errors.New("objects haven't been synced successfully yet")
 	}
+	return nil
 }
 
-func (s *Syncers) StartPeriodicSync(ctx context.Context) {
-	s.Sync()
-	// TODO make time configurable
-	ticker := time.NewTicker(60 * time.Second)
-	for {
-		select {
-		case t := <-ticker.C:
-			s.logger.Info("Periodic objects sync", "time", t)
-			s.Sync()
-		case <-ctx.Done():
-			return
+// Start runs the periodic sync until the context is done, syncers are run
+// by the manager only on the leader
+func (s *Syncers) Start(ctx context.Context) error {
+	if s.cache != nil {
+		err := WaitForInformers(ctx, s.cache, &apiv1.VPC{}, &apiv1.Subnet{}, &apiv1.Instance{},
+			&apiv1.Site{}, &apiv1.VPN{}, &apiv1.NetworkDomain{},
+			&apiv1.InterNetworkDomainConnection{}, &apiv1.InterNetworkDomainAppConnection{})
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
 		}
 	}
+	s.StartPeriodicSync(ctx)
+	return nil
+}
+
+// NeedLeaderElection makes standby replicas leave discovered objects to
+// the leader
+func (s *Syncers) NeedLeaderElection() bool {
+	return true
+}
+
+// StartPeriodicSync syncs objects until the context is done, the interval
+// is counted from the end of the previous sync, so syncs never overlap
+func (s *Syncers) StartPeriodicSync(ctx context.Context) {
+	wait.UntilWithContext(ctx, s.Sync, s.interval)
 }
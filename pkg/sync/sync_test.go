@@ -0,0 +1,221 @@
+// Copyright (c) 2023 Cisco Systems, Inc. and its affiliates
+// All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http:www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package sync
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/stretchr/testify/mock"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8s_cl "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	apiv1 "app-net-interface.io/kube-awi/api/awi/v1alpha1"
+	awi_cl "app-net-interface.io/kube-awi/client"
+	awiMock "github.com/app-net-interface/awi-grpc/mocks"
+	awi "github.com/app-net-interface/awi-grpc/pb"
+)
+
+// discovered objects, each kind is listed in AWS only
+var (
+	syncedVPC      = &awi.VPC{ID: "vpc-1", Name: "app", Provider: "AWS", Region: "us-east-1"}
+	syncedSubnet   = &awi.Subnet{SubnetId: "subnet-1", CidrBlock: "10.0.1.0/24", VpcId: "vpc-1", Zone: "us-east-1a"}
+	syncedInstance = &awi.Instance{ID: "i-1", Name: "db", PrivateIP: "10.0.1.10", SubnetID: "subnet-1", VPCID: "vpc-1"}
+	syncedSite     = &awi.SiteDetail{ID: "site-1", Name: "branch", IP: "192.0.2.1", SiteID: "1"}
+	syncedVPN      = &awi.VPN{ID: "vpn-1", SegmentName: "corp", SegmentID: "10"}
+)
+
+func cloneSpec[T proto.Message](spec T) T {
+	return proto.Clone(spec).(T)
+}
+
+func objectMeta(name string) metav1.ObjectMeta {
+	return metav1.ObjectMeta{Name: name, Namespace: Namespace}
+}
+
+func expectDiscovered(m *awiMock.CloudClient) {
+	m.EXPECT().ListVPCs(mock.Anything, mock.Anything).RunAndReturn(
+		func(_ context.Context, req *awi.ListVPCRequest, _ ...grpc.CallOption) (*awi.ListVPCResponse, error) {
+			if req.GetProvider() != "AWS" {
+				return &awi.ListVPCResponse{}, nil
+			}
+			return &awi.ListVPCResponse{VPCs: []*awi.VPC{syncedVPC}}, nil
+		}).Maybe()
+	m.EXPECT().ListSubnets(mock.Anything, mock.Anything).RunAndReturn(
+		func(_ context.Context, req *awi.ListSubnetRequest, _ ...grpc.CallOption) (*awi.ListSubnetResponse, error) {
+			if req.GetProvider() != "AWS" {
+				return &awi.ListSubnetResponse{}, nil
+			}
+			return &awi.ListSubnetResponse{Subnets: []*awi.Subnet{syncedSubnet}}, nil
+		}).Maybe()
+	m.EXPECT().ListInstances(mock.Anything, mock.Anything).RunAndReturn(
+		func(_ context.Context, req *awi.ListInstancesRequest, _ ...grpc.CallOption) (*awi.ListInstancesResponse, error) {
+			if req.GetProvider() != "AWS" {
+				return &awi.ListInstancesResponse{}, nil
+			}
+			return &awi.ListInstancesResponse{Instances: []*awi.Instance{syncedInstance}}, nil
+		}).Maybe()
+	m.EXPECT().ListSites(mock.Anything, mock.Anything).
+		Return(&awi.ListSiteResponse{Sites: []*awi.SiteDetail{syncedSite}}, nil).Maybe()
+	m.EXPECT().ListVPNs(mock.Anything, mock.Anything).
+		Return(&awi.ListVPNResponse{VPNs: []*awi.VPN{syncedVPN}}, nil).Maybe()
+}
+
+func TestSyncUpdatesChangedObjects(t *testing.T) {
+	changedVPC := &awi.VPC{ID: "vpc-1", Name: "app-old", Provider: "AWS", Region: "us-east-1"}
+	changedSubnet := &awi.Subnet{SubnetId: "subnet-1", CidrBlock: "10.0.0.0/24", VpcId: "vpc-1"}
+	changedInstance := &awi.Instance{ID: "i-1", Name: "db", PrivateIP: "10.0.1.11", VPCID: "vpc-1"}
+	changedSite := &awi.SiteDetail{ID: "site-1", Name: "branch", IP: "192.0.2.2", SiteID: "1"}
+	changedVPN := &awi.VPN{ID: "vpn-1", SegmentName: "corp-old", SegmentID: "10"}
+
+	tests := []struct {
+		name        string
+		existing    k8s_cl.Object
+		newSyncer   func(k8s_cl.Client, *awi_cl.AwiGrpcClient) Syncer
+		wantUpdates int
+	}{
+		{
+			name:        "unchanged vpc",
+			existing:    &apiv1.VPC{ObjectMeta: objectMeta("aws.vpc-1"), Spec: *cloneSpec(syncedVPC)},
+			wantUpdates: 0,
+			newSyncer: func(k8sClient k8s_cl.Client, awiClient *awi_cl.AwiGrpcClient) Syncer {
+				return &VPCSyncer{k8sClient: k8sClient, awiClient: awiClient, logger: logr.Discard(), workers: newPool(1)}
+			},
+		},
+		{
+			name:        "changed vpc",
+			existing:    &apiv1.VPC{ObjectMeta: objectMeta("aws.vpc-1"), Spec: *changedVPC},
+			wantUpdates: 1,
+			newSyncer: func(k8sClient k8s_cl.Client, awiClient *awi_cl.AwiGrpcClient) Syncer {
+				return &VPCSyncer{k8sClient: k8sClient, awiClient: awiClient, logger: logr.Discard(), workers: newPool(1)}
+			},
+		},
+		{
+			name:        "unchanged subnet",
+			existing:    &apiv1.Subnet{ObjectMeta: objectMeta("aws.subnet-1"), Spec: *cloneSpec(syncedSubnet)},
+			wantUpdates: 0,
+			newSyncer: func(k8sClient k8s_cl.Client, awiClient *awi_cl.AwiGrpcClient) Syncer {
+				return &SubnetSyncer{k8sClient: k8sClient, awiClient: awiClient, logger: logr.Discard(), workers: newPool(1)}
+			},
+		},
+		{
+			name:        "changed subnet",
+			existing:    &apiv1.Subnet{ObjectMeta: objectMeta("aws.subnet-1"), Spec: *changedSubnet},
+			wantUpdates: 1,
+			newSyncer: func(k8sClient k8s_cl.Client, awiClient *awi_cl.AwiGrpcClient) Syncer {
+				return &SubnetSyncer{k8sClient: k8sClient, awiClient: awiClient, logger: logr.Discard(), workers: newPool(1)}
+			},
+		},
+		{
+			name:        "unchanged instance",
+			existing:    &apiv1.Instance{ObjectMeta: objectMeta("aws.i-1"), Spec: *cloneSpec(syncedInstance)},
+			wantUpdates: 0,
+			newSyncer: func(k8sClient k8s_cl.Client, awiClient *awi_cl.AwiGrpcClient) Syncer {
+				return &InstanceSyncer{k8sClient: k8sClient, awiClient: awiClient, logger: logr.Discard(), workers: newPool(1)}
+			},
+		},
+		{
+			name:        "changed instance",
+			existing:    &apiv1.Instance{ObjectMeta: objectMeta("aws.i-1"), Spec: *changedInstance},
+			wantUpdates: 1,
+			newSyncer: func(k8sClient k8s_cl.Client, awiClient *awi_cl.AwiGrpcClient) Syncer {
+				return &InstanceSyncer{k8sClient: k8sClient, awiClient: awiClient, logger: logr.Discard(), workers: newPool(1)}
+			},
+		},
+		{
+			name:        "unchanged site",
+			existing:    &apiv1.Site{ObjectMeta: objectMeta("site-1"), Spec: *cloneSpec(syncedSite)},
+			wantUpdates: 0,
+			newSyncer: func(k8sClient k8s_cl.Client, awiClient *awi_cl.AwiGrpcClient) Syncer {
+				return &SiteSyncer{k8sClient: k8sClient, awiClient: awiClient, logger: logr.Discard()}
+			},
+		},
+		{
+			name:        "changed site",
+			existing:    &apiv1.Site{ObjectMeta: objectMeta("site-1"), Spec: *changedSite},
+			wantUpdates: 1,
+			newSyncer: func(k8sClient k8s_cl.Client, awiClient *awi_cl.AwiGrpcClient) Syncer {
+				return &SiteSyncer{k8sClient: k8sClient, awiClient: awiClient, logger: logr.Discard()}
+			},
+		},
+		{
+			name:        "unchanged vpn",
+			existing:    &apiv1.VPN{ObjectMeta: objectMeta("vpn-1"), Spec: *cloneSpec(syncedVPN)},
+			wantUpdates: 0,
+			newSyncer: func(k8sClient k8s_cl.Client, awiClient *awi_cl.AwiGrpcClient) Syncer {
+				return &VPNSyncer{k8sClient: k8sClient, awiClient: awiClient, logger: logr.Discard()}
+			},
+		},
+		{
+			name:        "changed vpn",
+			existing:    &apiv1.VPN{ObjectMeta: objectMeta("vpn-1"), Spec: *changedVPN},
+			wantUpdates: 1,
+			newSyncer: func(k8sClient k8s_cl.Client, awiClient *awi_cl.AwiGrpcClient) Syncer {
+				return &VPNSyncer{k8sClient: k8sClient, awiClient: awiClient, logger: logr.Discard()}
+			},
+		},
+	}
+
+	scheme := runtime.NewScheme()
+	if err := apiv1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cloudClient := awiMock.NewCloudClient(t)
+			expectDiscovered(cloudClient)
+			awiClient := &awi_cl.AwiGrpcClient{CloudClient: cloudClient}
+
+			var updates, otherWrites int
+			k8sClient := fake.NewClientBuilder().WithScheme(scheme).WithObjects(tt.existing).
+				WithInterceptorFuncs(interceptor.Funcs{
+					Update: func(ctx context.Context, c k8s_cl.WithWatch, obj k8s_cl.Object,
+						opts ...k8s_cl.UpdateOption) error {
+						updates++
+						return c.Update(ctx, obj, opts...)
+					},
+					Create: func(ctx context.Context, c k8s_cl.WithWatch, obj k8s_cl.Object,
+						opts ...k8s_cl.CreateOption) error {
+						otherWrites++
+						return c.Create(ctx, obj, opts...)
+					},
+					Delete: func(ctx context.Context, c k8s_cl.WithWatch, obj k8s_cl.Object,
+						opts ...k8s_cl.DeleteOption) error {
+						otherWrites++
+						return c.Delete(ctx, obj, opts...)
+					},
+				}).Build()
+
+			if err := tt.newSyncer(k8sClient, awiClient).Sync(context.Background()); err != nil {
+				t.Fatalf("Sync() error = %v", err)
+			}
+			if updates != tt.wantUpdates {
+				t.Errorf("Update called %d times, want %d", updates, tt.wantUpdates)
+			}
+			if otherWrites != 0 {
+				t.Errorf("existing object was created or deleted %d times", otherWrites)
+			}
+		})
+	}
+}
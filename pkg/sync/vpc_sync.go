@@ -20,10 +20,11 @@ package sync
 import (
 	"context"
 	"fmt"
+	"slices"
 	"strings"
-	"time"
 
 	"github.com/go-logr/logr"
+	"google.golang.org/protobuf/proto"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	k8s_cl "sigs.k8s.io/controller-runtime/pkg/client"
 
@@ -40,21 +41,27 @@ type VPCSyncer struct {
 	k8sClient k8s_cl.Client
 	awiClient *awi_cl.AwiGrpcClient
 	logger    logr.Logger
+	// workers is shared by all syncers, it bounds how many clouds are
+	// listed at the same time
+	workers pool
+	// filter selects which of discovered objects are synced
+	filter Filter
 }
 
-func (s *VPCSyncer) Sync() error {
-	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
-	defer cancel()
-
+func (s *VPCSyncer) Sync(ctx context.Context) error {
 	var err error
 	var existingVPCs []*awi.VPC
-	for _, cloud := range SupportedClouds {
-		cloudVPCs, err := s.awiClient.ListVPCs(cloud)
-		existingVPCs = append(existingVPCs, cloudVPCs...)
-		if err != nil {
-			return err
-		}
+	cloudVPCs, err := listPerCloud(ctx, s.workers, s.awiClient.ListVPCs)
+	if err != nil {
+		return err
 	}
+	for _, vpcs := range cloudVPCs {
+		existingVPCs = append(existingVPCs, vpcs...)
+	}
+
+	existingVPCs = slices.DeleteFunc(existingVPCs, func(vpc *awi.VPC) bool {
+		return !s.filter.matches(vpcObject(vpc))
+	})
 
 	var vpcList apiv1.VPCList
 	err = s.k8sClient.List(ctx, &vpcList, k8s_cl.InNamespace(Namespace))
@@ -67,10 +74,18 @@ func (s *VPCSyncer) Sync() error {
 	}
 
 	for _, vpc := range existingVPCs {
-		_, ok := vpcCRDMap[getVpcCRDName(vpc)]
+		existing, ok := vpcCRDMap[getVpcCRDName(vpc)]
 		if ok {
 			// if it's already present remove it from map
 			delete(vpcCRDMap, getVpcCRDName(vpc))
+			if proto.Equal(&existing.Spec, vpc) {
+				continue
+			}
+			existing.Spec = *vpc
+			s.logger.Info("Updating changed VPC CRD", "name", existing.GetName())
+			if err := s.k8sClient.Update(ctx, &existing); err != nil {
+				return err
+			}
 			continue
 		}
 		newVPCCRD := apiv1.VPC{
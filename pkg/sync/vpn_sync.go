@@ -20,9 +20,9 @@ package sync
 import (
 	"context"
 	"fmt"
-	"time"
 
 	"github.com/go-logr/logr"
+	"google.golang.org/protobuf/proto"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	k8s_cl "sigs.k8s.io/controller-runtime/pkg/client"
 
@@ -41,10 +41,8 @@ type VPNSyncer struct {
 	logger    logr.Logger
 }
 
-func (s *VPNSyncer) Sync() error {
-	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
-	defer cancel()
-	existingVPNs, err := s.awiClient.ListVPNs()
+func (s *VPNSyncer) Sync(ctx context.Context) error {
+	existingVPNs, err := s.awiClient.ListVPNs(ctx)
 	if err != nil {
 		return err
 	}
@@ -60,10 +58,18 @@ func (s *VPNSyncer) Sync() error {
 	}
 
 	for _, vpn := range existingVPNs {
-		_, ok := vpnCRDMap[getVPNCRDName(vpn)]
+		existing, ok := vpnCRDMap[getVPNCRDName(vpn)]
 		if ok {
 			// if it's already present remove it from map
 			delete(vpnCRDMap, getVPNCRDName(vpn))
+			if proto.Equal(&existing.Spec, vpn) {
+				continue
+			}
+			existing.Spec = *vpn
+			s.logger.Info("Updating changed VPN CRD", "name", existing.GetName())
+			if err := s.k8sClient.Update(ctx, &existing); err != nil {
+				return err
+			}
 			continue
 		}
 		newVPNCRD := apiv1.VPN{
@@ -0,0 +1,90 @@
+// Copyright (c) 2023 Cisco Systems, Inc. and its affiliates
+// All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http:www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package sync
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// DefaultSyncWorkers is how many AWI calls of a sync, listing a kind or a
+// single cloud of a kind, are made at the same time
+const DefaultSyncWorkers = 4
+
+// pool bounds how many AWI calls of a sync are made at the same time, it's
+// shared by syncers and by clouds listed within a syncer, so nesting
+// doesn't multiply the limit
+type pool chan struct{}
+
+func newPool(workers int) pool {
+	return make(pool, max(workers, 1))
+}
+
+// forEach calls fn for each index below n, every call takes a slot of the
+// pool, and waits for all of them
+func (p pool) forEach(n int, fn func(i int)) {
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		p <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-p
+				wg.Done()
+			}()
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+}
+
+// forEachNested is forEach for callers which already hold a slot, a call
+// runs concurrently only if another slot is free, otherwise it's made in
+// the slot of the caller. A nil pool makes the calls one by one.
+func (p pool) forEachNested(n int, fn func(i int)) {
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		select {
+		case p <- struct{}{}:
+			wg.Add(1)
+			go func(i int) {
+				defer func() {
+					<-p
+					wg.Done()
+				}()
+				fn(i)
+			}(i)
+		default:
+			fn(i)
+		}
+	}
+	wg.Wait()
+}
+
+// listPerCloud lists objects of every supported cloud, concurrently as far
+// as the pool allows, the result holds them in the order of SupportedClouds
+func listPerCloud[T any](ctx context.Context, workers pool,
+	list func(ctx context.Context, cloud string) ([]T, error)) ([][]T, error) {
+	results := make([][]T, len(SupportedClouds))
+	errs := make([]error, len(SupportedClouds))
+	workers.forEachNested(len(SupportedClouds), func(i int) {
+		results[i], errs[i] = list(ctx, SupportedClouds[i])
+	})
+	return results, errors.Join(errs...)
+}
@@ -0,0 +1,178 @@
+// Copyright (c) 2023 Cisco Systems, Inc. and its affiliates
+// All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http:www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// concurrency records the highest number of calls running at once
+type concurrency struct {
+	running atomic.Int32
+	highest atomic.Int32
+}
+
+func (c *concurrency) run() {
+	n := c.running.Add(1)
+	for {
+		highest := c.highest.Load()
+		if n <= highest || c.highest.CompareAndSwap(highest, n) {
+			break
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+	c.running.Add(-1)
+}
+
+// withinTimeout fails the test if fn doesn't return in time, so a deadlock
+// is reported instead of hanging
+func withinTimeout(t *testing.T, fn func()) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn()
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("calls didn't finish, they're deadlocked")
+	}
+}
+
+func TestPoolForEach(t *testing.T) {
+	for _, workers := range []int{0, 1, 2, 4} {
+		t.Run(fmt.Sprintf("workers %d", workers), func(t *testing.T) {
+			var c concurrency
+			var calls [10]atomic.Bool
+			withinTimeout(t, func() {
+				newPool(workers).forEach(len(calls), func(i int) {
+					calls[i].Store(true)
+					c.run()
+				})
+			})
+			for i := range calls {
+				if !calls[i].Load() {
+					t.Errorf("workers %d: fn(%d) wasn't called", workers, i)
+				}
+			}
+			if highest := int(c.highest.Load()); highest > max(workers, 1) {
+				t.Errorf("workers %d: %d calls ran at once", workers, highest)
+			}
+		})
+	}
+}
+
+func TestPoolForEachNested(t *testing.T) {
+	for _, workers := range []int{1, 2, 3} {
+		t.Run(fmt.Sprintf("workers %d", workers), func(t *testing.T) {
+			var c concurrency
+			var calls atomic.Int32
+			withinTimeout(t, func() {
+				p := newPool(workers)
+				p.forEach(3, func(int) {
+					p.forEachNested(3, func(int) {
+						p.forEachNested(2, func(int) {
+							calls.Add(1)
+							c.run()
+						})
+					})
+				})
+			})
+			if got := calls.Load(); got != 18 {
+				t.Errorf("workers %d: %d calls, want 18", workers, got)
+			}
+			if highest := int(c.highest.Load()); highest > workers {
+				t.Errorf("workers %d: %d calls ran at once", workers, highest)
+			}
+		})
+	}
+}
+
+func TestNilPoolForEachNested(t *testing.T) {
+	var c concurrency
+	var order []int
+	withinTimeout(t, func() {
+		var p pool
+		p.forEachNested(3, func(i int) {
+			order = append(order, i)
+			c.run()
+		})
+	})
+	if len(order) != 3 || order[0] != 0 || order[1] != 1 || order[2] != 2 {
+		t.Errorf("calls made in order %v, want [0 1 2]", order)
+	}
+	if highest := c.highest.Load(); highest != 1 {
+		t.Errorf("%d calls ran at once, want 1", highest)
+	}
+}
+
+func TestListPerCloud(t *testing.T) {
+	list := func(_ context.Context, cloud string) ([]string, error) {
+		// the first cloud answers last
+		if cloud == SupportedClouds[0] {
+			time.Sleep(10 * time.Millisecond)
+		}
+		return []string{cloud + "-object"}, nil
+	}
+	for _, workers := range []int{1, 2} {
+		var results [][]string
+		var err error
+		withinTimeout(t, func() {
+			p := newPool(workers)
+			// the caller holds a slot, as syncers listing a kind do
+			p.forEach(1, func(int) {
+				results, err = listPerCloud(context.Background(), p, list)
+			})
+		})
+		if err != nil {
+			t.Fatalf("workers %d: listPerCloud() error = %v", workers, err)
+		}
+		if len(results) != len(SupportedClouds) {
+			t.Fatalf("workers %d: listPerCloud() returned %d clouds, want %d",
+				workers, len(results), len(SupportedClouds))
+		}
+		for i, cloud := range SupportedClouds {
+			if len(results[i]) != 1 || results[i][0] != cloud+"-object" {
+				t.Errorf("workers %d: result %d = %v, want objects of %s", workers, i, results[i], cloud)
+			}
+		}
+	}
+}
+
+func TestListPerCloudErrors(t *testing.T) {
+	errFailed := errors.New("failed")
+	results, err := listPerCloud(context.Background(), newPool(1),
+		func(_ context.Context, cloud string) ([]string, error) {
+			if cloud == SupportedClouds[1] {
+				return nil, errFailed
+			}
+			return []string{cloud}, nil
+		})
+	if !errors.Is(err, errFailed) {
+		t.Errorf("listPerCloud() error = %v, want %v", err, errFailed)
+	}
+	if len(results[0]) != 1 {
+		t.Errorf("objects of the cloud listed successfully = %v, want them kept", results[0])
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright (c) 2023 Cisco Systems, Inc. and its affiliates
+// All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http:www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+type tracedReconciler struct {
+	kind       string
+	reconciler reconcile.Reconciler
+}
+
+// Reconciler wraps the reconciler of the given kind, so each Reconcile
+// call is done in a span. Calls to AWI made with the reconcile context
+// are its children.
+func Reconciler(kind string, r reconcile.Reconciler) reconcile.Reconciler {
+	return &tracedReconciler{kind: kind, reconciler: r}
+}
+
+func (t *tracedReconciler) Reconcile(ctx context.Context, req reconcile.Request) (reconcile.Result, error) {
+	ctx, span := Start(ctx, t.kind+".Reconcile",
+		attribute.String("k8s.namespace.name", req.Namespace),
+		attribute.String("k8s.object.name", req.Name))
+	result, err := t.reconciler.Reconcile(ctx, req)
+	if result.RequeueAfter > 0 {
+		span.SetAttributes(attribute.String("requeue.after", result.RequeueAfter.String()))
+	}
+	End(span, err)
+	return result, err
+}